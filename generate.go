@@ -1,23 +1,85 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 
 	"github.com/fischor/protoc-gen-ts/internal/prototype"
-	"github.com/iancoleman/strcase"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
-func generateFile(gen *protogen.Plugin, file *protogen.File, params parameter) *protogen.GeneratedFile {
+// configure sets the options of package prototype from params.
+func configure(params parameter) {
 	if params.WellKnownPath != "" {
 		prototype.WellKnownPath = params.WellKnownPath
 	}
+	prototype.GenerateWellKnownTypes = params.GenerateWellKnown
+	prototype.Mappings = params.ImportMap
+	prototype.Flatten = params.Flatten
+	prototype.Paths = params.Paths
+	if params.ImportStyle == importStyleESM {
+		prototype.ImportSuffix = ".js"
+	}
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File, params parameter) *Printer {
+	printers := newPrinters(gen, prototype.Path(file.Desc), file.Desc, params)
+	for _, p := range printers {
+		prototype.Qualify = p
+		genFile(gen, file, p, params)
+	}
+	return printers[0]
+}
+
+// genFile generates the declarations for file.
+func genFile(gen *protogen.Plugin, file *protogen.File, p *Printer, params parameter) {
+	genHeader(gen, file, p)
+	p.P()
+
+	// The imports are generated once the declarations are, since unused
+	// imports are omitted.
+	p.Mark()
+	defer p.Insert(func() {
+		genImports(gen, file, p, params)
+		p.P()
+	})
+
+	genPublicImports(gen, file, p)
+
+	if params.EmbedDescriptors {
+		genFileDescriptor(gen, file, p)
+		p.P()
+	}
 
-	g := gen.NewGeneratedFile(prototype.Path(file.Desc), file.GoImportPath)
-	p := newPrinter(g)
+	for _, enum := range file.Enums {
+		genEnum(gen, file, p, enum)
+		p.P()
+	}
+
+	for _, msg := range file.Messages {
+		genMessage(gen, file, p, msg, params)
+		p.P()
+	}
+
+	if !params.SeparateServices {
+		for _, svc := range file.Services {
+			genService(gen, file, p, svc, params)
+			p.P()
+		}
+	}
+
+	for _, ext := range file.Extensions {
+		genExtension(gen, file, p, ext)
+		p.P()
+	}
+}
 
+// genHeader generates the comment that leads every file generated for file.
+func genHeader(gen *protogen.Plugin, file *protogen.File, p *Printer) {
 	p.P("// Code generated by protoc-gen-ts. DO NOT EDIT.")
 	p.P("// versions:")
 	p.P("// 	protoc-gen-go ", "v0.0.1-devel")
@@ -31,48 +93,103 @@ func generateFile(gen *protogen.Plugin, file *protogen.File, params parameter) *
 		*gen.Request.CompilerVersion.Patch,
 		suffix)
 	p.P("// source: ", file.Desc.Path())
-	p.P()
-
-	genImports(gen, file, p)
-	p.P()
+}
 
-	for _, enum := range file.Enums {
-		genEnum(gen, file, p, enum)
-		p.P()
+func genImports(gen *protogen.Plugin, file *protogen.File, g *Printer, params parameter) {
+	genPackageImport(g, "jspb", "google-protobuf", params)
+	genPackageImport(g, "grpcweb", "grpc-web", params)
+	for _, mod := range g.modules {
+		genModuleImport(g, mod.Alias, mod.Path, params)
 	}
+	genModuleImport(g, "runtime", prototype.RuntimeImportPath(file.Desc), params)
+}
 
-	for _, msg := range file.Messages {
-		genMessage(gen, file, p, msg)
-		p.P()
+// genPublicImports re-exports the declarations of the files that file imports
+// publicly, so that these are available to the files that import file, like
+// in proto.
+func genPublicImports(gen *protogen.Plugin, file *protogen.File, p *Printer) {
+	imps := prototype.PublicImports(file.Desc)
+	for _, imp := range imps {
+		p.P("export * from \"", imp.Path, "\";")
 	}
-
-	for _, svc := range file.Services {
-		genService(gen, file, p, svc)
+	if len(imps) > 0 {
 		p.P()
 	}
+}
 
-	for _, ext := range file.Extensions {
-		genExtension(gen, file, p, ext)
-		p.P()
+// genPackageImport generates the import of the npm package pkg as alias, if
+// alias is used by the code printed by g.
+//
+// With the default import style, the default export of pkg is imported, which
+// requires esModuleInterop for CommonJS packages like google-protobuf.
+func genPackageImport(g *Printer, alias, pkg string, params parameter) {
+	used, typeOnly := g.Uses(alias)
+	if !used {
+		return
+	}
+	switch params.ImportStyle {
+	case importStyleESM:
+		g.P(importKeyword(typeOnly), "* as ", alias, " from \"", pkg, "\";")
+	case importStyleCommonJS:
+		g.P(importKeyword(typeOnly), alias, " = require(\"", pkg, "\");")
+	default:
+		g.P(importKeyword(typeOnly), alias, " from \"", pkg, "\";")
 	}
-
-	return g
 }
 
-func genImports(gen *protogen.Plugin, file *protogen.File, g *Printer) {
-	if len(file.Messages) > 0 || len(file.Extensions) > 0 {
-		g.P("import jspb from \"google-protobuf\";")
-
+// genModuleImport generates the namespace import of the module at path as
+// alias, if alias is used by the code printed by g.
+func genModuleImport(g *Printer, alias, path string, params parameter) {
+	used, typeOnly := g.Uses(alias)
+	if !used {
+		return
 	}
-	if len(file.Services) > 0 {
-		g.P("import grpcweb from \"grpc-web\";")
+	switch params.ImportStyle {
+	case importStyleCommonJS:
+		g.P(importKeyword(typeOnly), alias, " = require(\"", path, "\");")
+	default:
+		g.P(importKeyword(typeOnly), "* as ", alias, " from \"", path, "\";")
 	}
-	// TODO: rename inmport for file to Imports make imp.Alias and imp.Path
-	// fields instead of methods.
-	imps := prototype.Imports(file.Desc)
-	for _, imp := range imps {
-		g.P("import * as ", imp.Alias, " from \"", imp.Path, "\";")
+}
+
+// importKeyword returns the keyword that starts an import, i.e. "import type"
+// for imports that are used at type level only. These are elided by the
+// Typescript compiler regardless of importsNotUsedAsValues and
+// verbatimModuleSyntax.
+func importKeyword(typeOnly bool) string {
+	if typeOnly {
+		return "import type "
+	}
+	return "import "
+}
+
+// usesRuntime reports whether the file generated for file makes use of the
+// runtime support file.
+func usesRuntime(file *protogen.File, params parameter) bool {
+	// Clients fail with runtime.StatusError.
+	for _, svc := range file.Services {
+		if len(svc.Methods) > 0 {
+			return true
+		}
 	}
+	return len(file.Messages) > 0 || params.EmbedDescriptors
+}
+
+// genFileDescriptor registers the serialized FileDescriptorProto of file in the
+// registry of the runtime support file.
+//
+// Source code info is stripped from the descriptor since it is not needed at
+// runtime.
+func genFileDescriptor(gen *protogen.Plugin, file *protogen.File, p *Printer) {
+	fdp := proto.Clone(file.Proto).(*descriptorpb.FileDescriptorProto)
+	fdp.SourceCodeInfo = nil
+	b, err := proto.Marshal(fdp)
+	if err != nil {
+		panic(err)
+	}
+	p.Impl(func() {
+		p.P(p.Runtime("registerFile"), "(\"", file.Desc.Path(), "\", \"", base64.StdEncoding.EncodeToString(b), "\");")
+	})
 }
 
 // extend google.protobuf.MessageOptions {
@@ -135,7 +252,11 @@ func genExtension(gen *protogen.Plugin, file *protogen.File, p *Printer, extensi
 	// 	    isRepeated: number);
 	// 	}
 	extensionFieldInfo := fmt.Sprint("ExtensionFieldInfo_", extension.Extendee.GoIdent.GoName, "_", extension.GoName)
-	p.P("export const ", extensionFieldInfo, " = new jspb.ExtensionFieldInfo(")
+	extensionType := prototype.Type(extension.Desc)
+	if extension.Desc.Cardinality() == protoreflect.Repeated {
+		extensionType = "Array<" + extensionType + ">"
+	}
+	p.Begin(" = new "+p.JSPB("ExtensionFieldInfo")+"(", p.Decl("const", extensionFieldInfo), p.T(": "+p.JSPB("ExtensionFieldInfo")+"<"+extensionType+">"))
 	p.Indent()
 	p.P(extension.Desc.Number(), ",")
 	p.P("{", extension.Desc.JSONName(), ": 0},")
@@ -143,7 +264,9 @@ func genExtension(gen *protogen.Plugin, file *protogen.File, p *Printer, extensi
 		// For messages, there the ctor is the message itself, the
 		// toObjectFn is it toObject funtion.
 		p.P(prototype.Type(extension.Desc), ",")
-		p.P("// @ts-ignore")
+		p.Types(func() {
+			p.P("// @ts-ignore")
+		})
 		p.P(prototype.Type(extension.Desc), ".toObject,")
 	} else {
 		// For scalar, there is no ctor and no toObjectFn, use null
@@ -159,7 +282,7 @@ func genExtension(gen *protogen.Plugin, file *protogen.File, p *Printer, extensi
 		p.P("0")
 	}
 	p.Outdent()
-	p.P(");")
+	p.End(");")
 	p.P()
 
 	// Add the extension to the status [File|Message|Method]Option map.
@@ -175,14 +298,24 @@ func genExtension(gen *protogen.Plugin, file *protogen.File, p *Printer, extensi
 	//     opt_isPacked: boolean);
 	// }
 	optionName := prototype.NameInContext(extension.Desc.ParentFile(), extension.Desc.ContainingMessage())
-	p.P(optionName, ".extensionsBinary[", extension.Desc.Number(), "] = new jspb.ExtensionFieldBinaryInfo(")
+	p.Impl(func() {
+		genExtensionRegistration(p, extension, extensionFieldInfo, optionName)
+	})
+}
+
+// genExtensionRegistration registers the extension at the message it extends,
+// named optionName.
+func genExtensionRegistration(p *Printer, extension *protogen.Extension, extensionFieldInfo, optionName string) {
+	p.P(optionName, ".extensionsBinary[", extension.Desc.Number(), "] = new ", p.JSPB("ExtensionFieldBinaryInfo"), "(")
 	p.Indent()
 	p.P(extensionFieldInfo, ",")
-	p.P("jspb.BinaryReader.prototype.", prototype.BinaryReaderFunc(extension.Desc), ",")
-	p.P("jspb.BinaryWriter.prototype.", prototype.BinaryWriterFunc(extension.Desc), ",")
+	p.P(p.JSPB("BinaryReader"), ".prototype.", prototype.BinaryReaderFunc(extension.Desc), ",")
+	p.P(p.JSPB("BinaryWriter"), ".prototype.", prototype.BinaryWriterFunc(extension.Desc), ",")
 	// opt_binaryMessageSerializeFn and opt_binaryMessageDeserializeFn
 	if extension.Desc.Kind() == protoreflect.MessageKind {
-		p.P("// @ts-ignore")
+		p.Types(func() {
+			p.P("// @ts-ignore")
+		})
 		p.P(prototype.Type(extension.Desc), ".serializeBinaryToWriter,")
 		p.P(prototype.Type(extension.Desc), ".deserializeBinaryFromReader,")
 	} else {
@@ -203,41 +336,79 @@ func genExtension(gen *protogen.Plugin, file *protogen.File, p *Printer, extensi
 }
 
 func genEnum(gen *protogen.Plugin, file *protogen.File, p *Printer, enum *protogen.Enum) {
-	p.P("export enum ", enum.Desc.Name(), " {")
-	p.Indent()
+	var values []enumValue
 	for _, val := range enum.Values {
-		p.P(val.Desc.Name(), " = ", val.Desc.Number(), ",")
+		values = append(values, enumValue{Name: string(val.Desc.Name()), Number: int32(val.Desc.Number())})
+	}
+	genEnumDecl(p, prototype.LocalName(enum.Desc), values)
+}
+
+// enumValue is a value of an enum declared by genEnumDecl.
+type enumValue struct {
+	Name   string
+	Number int32
+}
+
+// genEnumDecl generates the exported enum name with the given values.
+func genEnumDecl(p *Printer, name string, values []enumValue) {
+	if p.mode == modeJS {
+		// Generate the enum object like the Typescript compiler does,
+		// including the mapping of values to names.
+		p.P(p.Decl("var", name), ";")
+		p.P("(function (", name, ") {")
+		p.Indented(func() {
+			for _, val := range values {
+				p.P(name, "[", name, "[\"", val.Name, "\"] = ", val.Number, "] = \"", val.Name, "\";")
+			}
+		})
+		p.P("})(", name, " || (", name, " = {}));")
+		return
+	}
+	p.P(p.Decl("enum", name), " {")
+	p.Indent()
+	for _, val := range values {
+		p.P(val.Name, " = ", val.Number, ",")
 	}
 	p.Outdent()
 	p.P("}")
 }
 
-func genMessage(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
+func genMessage(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message, params parameter) {
 	// Generate constants for the repeated and oneof field numbers.
 	repeatedFields := prototype.RepeatedFields(msg.Desc)
 	oneofFields := prototype.OneofFields(msg.Desc)
-	p.P("const __", msg.Desc.Name(), "_repeated: number[] = ", toArray(repeatedFields), ";")
-	p.P()
-	p.P("const __", msg.Desc.Name(), "_oneof: number[][] = ", to2DArray(oneofFields), ";")
-	p.P()
+	p.Impl(func() {
+		p.P("const __", prototype.LocalName(msg.Desc), "_repeated", p.T(": number[]"), " = ", toArray(repeatedFields), ";")
+		p.P()
+		p.P("const __", prototype.LocalName(msg.Desc), "_oneof", p.T(": number[][]"), " = ", to2DArray(oneofFields), ";")
+		p.P()
+	})
 
 	if msg.Comments.Leading != "" {
 		p.P("/**")
 		p.C(msg.Comments.Leading)
 		p.P(" */")
 	}
-	p.P("export class ", msg.Desc.Name(), " extends jspb.Message {")
+	p.P(p.Decl("class", prototype.LocalName(msg.Desc)), " extends ", p.JSPB("Message"), " {")
 	p.P()
 	p.Indent()
 
+	if params.EmbedDescriptors {
+		p.P("static ", p.T("readonly "), "typeName = \"", msg.Desc.FullName(), "\";")
+		p.P()
+	}
+
+	genFieldInfos(gen, file, p, msg)
+	p.P()
+
 	// Generate statuc deserializeBinary method.
-	p.P("static deserializeBinary(bytes: Uint8Array): ", msg.Desc.Name(), " {")
+	p.Begin(" {", "static deserializeBinary(bytes", p.T(": Uint8Array"), ")", p.T(": "+prototype.LocalName(msg.Desc)))
 	p.Indented(func() {
-		p.P("let reader = new jspb.BinaryReader(bytes);")
-		p.P("let msg = new ", msg.Desc.Name(), "();")
-		p.P("return ", msg.Desc.Name(), ".deserializeBinaryFromReader(msg, reader);")
+		p.P("let reader = new ", p.JSPB("BinaryReader"), "(bytes);")
+		p.P("let msg = new ", prototype.LocalName(msg.Desc), "();")
+		p.P("return ", prototype.LocalName(msg.Desc), ".deserializeBinaryFromReader(msg, reader);")
 	})
-	p.P("}")
+	p.End("}")
 	p.P()
 
 	// Generate other static methods.
@@ -253,29 +424,29 @@ func genMessage(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *prot
 	// Generate constructor.
 	msgID := 0
 	suggestedPivot := -1
-	p.P("constructor(data?: jspb.Message.MessageArray) {")
+	p.Begin(" {", "constructor(data", p.T("?: "+p.JSPB("Message")+".MessageArray"), ")")
 	p.Indented(func() {
 		p.P("super();")
-		p.F("jspb.Message.initialize(this, data ?? [], %d, %d, __%[3]s_repeated, __%[3]s_oneof);", msgID, suggestedPivot, msg.Desc.Name())
+		p.F(p.JSPB("Message")+".initialize(this, data ?? [], %d, %d, __%[3]s_repeated, __%[3]s_oneof);", msgID, suggestedPivot, prototype.LocalName(msg.Desc))
 	})
-	p.P("}")
+	p.End("}")
 	p.P()
 
 	// Generate serializeBinary method.
-	p.P("serializeBinary(): Uint8Array {")
+	p.Begin(" {", "serializeBinary()", p.T(": Uint8Array"))
 	p.Indented(func() {
-		p.P("const writer = new jspb.BinaryWriter();")
-		p.P(msg.Desc.Name(), ".serializeBinaryToWriter(this, writer);")
+		p.P("const writer = new ", p.JSPB("BinaryWriter"), "();")
+		p.P(prototype.LocalName(msg.Desc), ".serializeBinaryToWriter(this, writer);")
 		p.P("return writer.getResultBuffer();")
 	})
-	p.P("}")
+	p.End("}")
 
 	// Generate toObject method
-	p.P("toObject(includeInstance?: boolean): ", msg.Desc.Name(), ".AsObject {")
+	p.Begin(" {", "toObject(includeInstance", p.T("?: boolean"), ")", p.T(": "+prototype.LocalAsObject(msg.Desc)))
 	p.Indented(func() {
-		p.P("return ", msg.Desc.Name(), ".toObject(includeInstance ?? false, this);")
+		p.P("return ", prototype.LocalName(msg.Desc), ".toObject(includeInstance ?? false, this);")
 	})
-	p.P("}")
+	p.End("}")
 
 	// Generate field methods
 	for _, field := range msg.Fields {
@@ -286,67 +457,126 @@ func genMessage(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *prot
 	p.P("}") // class end
 	p.P()
 
-	genMessageNamespace(gen, file, p, msg)
+	if params.EmbedDescriptors {
+		p.Impl(func() {
+			p.P(p.Runtime("registerMessage"), "(", prototype.LocalName(msg.Desc), ");")
+			p.P()
+		})
+	}
+
+	genMessageNamespace(gen, file, p, msg, params)
 }
 
-func genMessageNamespace(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
+// genFieldInfos generates the static fields property of msg, that describes
+// the fields of msg at runtime.
+func genFieldInfos(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
+	p.Begin(" = [", "static ", p.T("readonly "), "fields", p.T(": "+p.Runtime("FieldInfo")+"[]"))
+	p.Indented(func() {
+		for _, field := range msg.Fields {
+			info := []string{
+				fmt.Sprintf("no: %d", field.Desc.Number()),
+				fmt.Sprintf("name: %q", field.Desc.Name()),
+				fmt.Sprintf("jsonName: %q", field.Desc.JSONName()),
+				fmt.Sprintf("kind: %q", prototype.Kind(field.Desc)),
+				fmt.Sprintf("label: %q", prototype.Label(field.Desc)),
+			}
+			if field.Desc.IsMap() {
+				info = append(info, fmt.Sprintf("mapKey: %q", prototype.Kind(field.Desc.MapKey())))
+			}
+			if field.Oneof != nil {
+				info = append(info, fmt.Sprintf("oneof: %q", field.Oneof.Desc.Name()))
+			}
+			if ref := prototype.Ref(field.Desc); ref != "" {
+				info = append(info, "T: () => "+ref)
+			}
+			p.P("{ ", strings.Join(info, ", "), " },")
+		}
+	})
+	p.End("];")
+}
+
+func genMessageNamespace(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message, params parameter) {
+	if prototype.Flattened(file.Desc) {
+		// Without namespaces, the AsObject type and nested declarations
+		// are generated at the top level.
+		genAsObject(gen, file, p, msg, prototype.LocalAsObject(msg.Desc))
+		p.P()
+		genNestedDeclarations(gen, file, p, msg, params)
+		return
+	}
+
 	p.P("/**")
 	p.P(" * Namespace for the ", msg.Desc.Name(), ".")
 	p.P(" * Contains nested message and enum declarations.")
 	p.P(" */")
-	p.P("export namespace ", msg.Desc.Name(), "{")
+	p.BeginNamespace(string(msg.Desc.Name()))
 	p.P()
-	p.Indented(func() {
-		// Generate AsObject tyoe
-		p.P("export type AsObject = {")
-		p.Indented(func() {
-			for i, field := range msg.Fields {
-				var fieldType string
-				var optional bool
-				if field.Desc.IsMap() {
-					fieldType = "Array<[" + prototype.Type(field.Desc.MapKey()) + "," + prototype.Type(field.Desc.MapValue()) + "]>"
-				} else if field.Desc.IsList() && field.Desc.Kind() == protoreflect.MessageKind {
-					fieldType = "Array<" + prototype.Type(field.Desc) + ".AsObject>"
-				} else if field.Desc.IsList() {
-					fieldType = "Array<" + prototype.Type(field.Desc) + ">"
-				} else if field.Desc.Kind() == protoreflect.MessageKind {
-					fieldType = prototype.Type(field.Desc) + ".AsObject"
-					optional = true
-				} else {
-					fieldType = prototype.Type(field.Desc)
-				}
-				suffix := ","
-				if i == len(msg.Fields)-1 {
-					suffix = ""
-				}
-				optFlag := ""
-				if optional {
-					optFlag = "?"
-				}
-				p.P(prototype.NormalizedFieldName(field.Desc.JSONName()), optFlag, ": ", fieldType, suffix)
-			}
+	genAsObject(gen, file, p, msg, "AsObject")
+	p.P()
+	genNestedDeclarations(gen, file, p, msg, params)
+	p.EndNamespace()
+}
 
-		})
-		p.P("}")
-		p.P()
+// genAsObject generates the AsObject type for msg, that is declared as name.
+//
+// The AsObject type only exists at type level, thus nothing is generated for
+// it in JavaScript.
+func genAsObject(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message, name string) {
+	p.Types(func() {
+		genAsObjectType(gen, file, p, msg, name)
+	})
+}
 
-		// Generate nested enums.
-		for _, enum := range msg.Enums {
-			genEnum(gen, file, p, enum)
-			p.P()
+func genAsObjectType(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message, name string) {
+	p.P(p.Decl("type", name), " = {")
+	p.Indented(func() {
+		for i, field := range msg.Fields {
+			var fieldType string
+			var optional bool
+			if field.Desc.IsMap() {
+				fieldType = "Array<[" + prototype.Type(field.Desc.MapKey()) + "," + prototype.Type(field.Desc.MapValue()) + "]>"
+			} else if field.Desc.IsList() && field.Desc.Kind() == protoreflect.MessageKind {
+				fieldType = "Array<" + prototype.AsObject(field.Desc.ParentFile(), field.Desc.Message()) + ">"
+			} else if field.Desc.IsList() {
+				fieldType = "Array<" + prototype.Type(field.Desc) + ">"
+			} else if field.Desc.Kind() == protoreflect.MessageKind {
+				fieldType = prototype.AsObject(field.Desc.ParentFile(), field.Desc.Message())
+				optional = true
+			} else {
+				fieldType = prototype.Type(field.Desc)
+			}
+			suffix := ","
+			if i == len(msg.Fields)-1 {
+				suffix = ""
+			}
+			optFlag := ""
+			if optional {
+				optFlag = "?"
+			}
+			p.P(prototype.NormalizedFieldName(field.Desc.JSONName()), optFlag, ": ", fieldType, suffix)
 		}
 
-		// Generate nested messages.
-		for _, nested := range msg.Messages {
-			genMessage(gen, file, p, nested)
-			p.P()
-		}
 	})
-	p.P("}") // namespace end
+	p.P("}")
+}
+
+// genNestedDeclarations generates the enums and messages nested in msg.
+func genNestedDeclarations(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message, params parameter) {
+	// Generate nested enums.
+	for _, enum := range msg.Enums {
+		genEnum(gen, file, p, enum)
+		p.P()
+	}
+
+	// Generate nested messages.
+	for _, nested := range msg.Messages {
+		genMessage(gen, file, p, nested, params)
+		p.P()
+	}
 }
 
 func genDeserializeBinaryFromReader(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
-	p.P("static deserializeBinaryFromReader(msg: ", msg.Desc.Name(), ", reader: jspb.BinaryReader): ", msg.Desc.Name(), " {")
+	p.Begin(" {", "static deserializeBinaryFromReader(msg", p.T(": "+prototype.LocalName(msg.Desc)), ", reader", p.T(": "+p.JSPB("BinaryReader")), ")", p.T(": "+prototype.LocalName(msg.Desc)))
 	p.Indented(func() {
 		p.P("while (reader.nextField()) {")
 		p.Indented(func() {
@@ -376,7 +606,7 @@ func genDeserializeBinaryFromReader(gen *protogen.Plugin, file *protogen.File, p
 		p.P("}") // end while
 		p.P("return msg;")
 	})
-	p.P("}")
+	p.End("}")
 }
 
 func genDeserializeBinaryFromReaderCase(p *Printer, field *protogen.Field) {
@@ -384,12 +614,12 @@ func genDeserializeBinaryFromReaderCase(p *Printer, field *protogen.Field) {
 		p.P("let value = msg.", prototype.Get(field.Desc), "();")
 		p.P("reader.readMessage(value, (message, reader) =>")
 		p.Indented(func() {
-			p.P("jspb.Map.deserializeBinary(")
+			p.P(p.JSPB("Map"), ".deserializeBinary(")
 			p.Indented(func() {
 				p.P("message,")
 				p.P("reader,")
-				p.P("jspb.BinaryReader.prototype.", prototype.BinaryReaderFunc(field.Desc.MapKey()), ",")
-				p.P("jspb.BinaryReader.prototype.", prototype.BinaryReaderFunc(field.Desc.MapValue()), ",")
+				p.P(p.JSPB("BinaryReader"), ".prototype.", prototype.BinaryReaderFunc(field.Desc.MapKey()), ",")
+				p.P(p.JSPB("BinaryReader"), ".prototype.", prototype.BinaryReaderFunc(field.Desc.MapValue()), ",")
 				// TODO: comments
 				if field.Desc.MapValue().Kind() == protoreflect.MessageKind {
 					p.P(prototype.Type(field.Desc.MapValue()), ".deserializeBinaryFromReader,")
@@ -444,7 +674,7 @@ func genDeserializeBinaryFromReaderCase(p *Printer, field *protogen.Field) {
 }
 
 func genSerializeBinaryToWriter(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
-	p.P("static serializeBinaryToWriter(message: ", msg.Desc.Name(), ", writer: jspb.BinaryWriter) {")
+	p.Begin(" {", "static serializeBinaryToWriter(message", p.T(": "+prototype.LocalName(msg.Desc)), ", writer", p.T(": "+p.JSPB("BinaryWriter")), ")", p.T(": void"))
 	p.Indented(func() {
 		for _, field := range msg.Fields {
 			p.P("let field", field.Desc.Number(), " = message.", prototype.Get(field.Desc), "();")
@@ -456,7 +686,7 @@ func genSerializeBinaryToWriter(gen *protogen.Plugin, file *protogen.File, p *Pr
 			p.P("}")
 		}
 	})
-	p.P("}")
+	p.End("}")
 }
 
 func serializeCompare(fd protoreflect.FieldDescriptor) string {
@@ -515,8 +745,8 @@ func genSerializeToWriterCase(p *Printer, field *protogen.Field) {
 			p.Indented(func() {
 				p.P(field.Desc.Number(), ",")
 				p.P("writer, ")
-				p.P("jspb.BinaryWriter.prototype.", prototype.BinaryWriterFunc(field.Desc.MapKey()), ",")
-				p.P("jspb.BinaryWriter.prototype.writeMessage, ")
+				p.P(p.JSPB("BinaryWriter"), ".prototype.", prototype.BinaryWriterFunc(field.Desc.MapKey()), ",")
+				p.P(p.JSPB("BinaryWriter"), ".prototype.writeMessage, ")
 				p.P(prototype.Type(field.Desc.MapValue()), ".serializeBinaryToWriter")
 			})
 			p.P(");")
@@ -526,8 +756,8 @@ func genSerializeToWriterCase(p *Printer, field *protogen.Field) {
 		p.Indented(func() {
 			p.P(field.Desc.Number(), ",")
 			p.P("writer, ")
-			p.P("jspb.BinaryWriter.prototype.", prototype.BinaryWriterFunc(field.Desc.MapKey()), ",")
-			p.P("jspb.BinaryWriter.prototype.", prototype.BinaryWriterFunc(field.Desc.MapValue()))
+			p.P(p.JSPB("BinaryWriter"), ".prototype.", prototype.BinaryWriterFunc(field.Desc.MapKey()), ",")
+			p.P(p.JSPB("BinaryWriter"), ".prototype.", prototype.BinaryWriterFunc(field.Desc.MapValue()))
 		})
 		p.P(");")
 		return
@@ -551,7 +781,7 @@ func genSerializeToWriterCase(p *Printer, field *protogen.Field) {
 
 // genToObject generates the static toObject method for msg.
 func genToObject(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *protogen.Message) {
-	p.P("static toObject(includeInstance: boolean, msg: ", msg.Desc.Name(), "): ", msg.Desc.Name(), ".AsObject {")
+	p.Begin(" {", "static toObject(includeInstance", p.T(": boolean"), ", msg", p.T(": "+prototype.LocalName(msg.Desc)), ")", p.T(": "+prototype.LocalAsObject(msg.Desc)))
 	p.Indented(func() {
 		p.P("return {")
 		for i, field := range msg.Fields {
@@ -568,7 +798,7 @@ func genToObject(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *pro
 			if field.Desc.IsMap() {
 				op = fmt.Sprintf("msg.%[1]s()?.toObject(includeInstance ?? false) ?? []", getter)
 			} else if field.Desc.IsList() && field.Desc.Kind() == protoreflect.MessageKind {
-				op = fmt.Sprintf("jspb.Message.toObjectList(msg.%s(), %s.toObject, includeInstance)", getter, prototype.Ctor(field.Desc))
+				op = fmt.Sprintf(p.JSPB("Message")+".toObjectList(msg.%s(), %s.toObject, includeInstance)", getter, prototype.Ctor(field.Desc))
 			} else if field.Desc.IsList() && field.Desc.Kind() != protoreflect.MessageKind {
 				op = fmt.Sprintf("msg.%s()", getter)
 			} else if field.Desc.Kind() == protoreflect.MessageKind {
@@ -581,7 +811,7 @@ func genToObject(gen *protogen.Plugin, file *protogen.File, p *Printer, msg *pro
 		}
 		p.P("}")
 	})
-	p.P("}")
+	p.End("}")
 }
 
 // TODO docs:
@@ -598,261 +828,176 @@ func genFieldMethods(gen *protogen.Plugin, file *protogen.File, p *Printer, fiel
 	if field.Oneof != nil {
 		if field.Desc.Kind() == protoreflect.MessageKind {
 			// Get for wrapper, oneof fields.
-			p.P(prototype.Get(field.Desc), "(): ", prototype.Type(field.Desc), " | undefined {")
+			p.Begin(" {", prototype.Get(field.Desc), "()", p.T(": "+prototype.Type(field.Desc)+" | undefined"))
 			p.Indented(func() {
-				p.F("return jspb.Message.getFieldWithDefault(this, %d, undefined) as %s | undefined;", field.Desc.Number(), prototype.Type(field.Desc))
+				p.P("return ", p.JSPB("Message"), ".getFieldWithDefault(this, ", field.Desc.Number(), ", undefined)", p.T(" as "+prototype.Type(field.Desc)+" | undefined"), ";")
 			})
-			p.P("}")
+			p.End("}")
 			p.P()
 		} else {
 			// Get for non-wrapper, oneof fields.
-			p.P(prototype.Get(field.Desc), "(): ", prototype.Type(field.Desc), "{")
+			p.Begin("{", prototype.Get(field.Desc), "()", p.T(": "+prototype.Type(field.Desc)))
 			p.Indented(func() {
-				p.F("return jspb.Message.getFieldWithDefault(this, %d, %s);", field.Desc.Number(), prototype.Default(field.Desc))
+				p.F("return "+p.JSPB("Message")+".getFieldWithDefault(this, %d, %s);", field.Desc.Number(), prototype.Default(field.Desc))
 			})
-			p.P("}")
+			p.End("}")
 			p.P()
 		}
-		p.P(prototype.Has(field.Desc), "(): boolean {")
+		p.Begin(" {", prototype.Has(field.Desc), "()", p.T(": boolean"))
 		p.Indented(func() {
-			p.F("return jspb.Message.getField(this, %d) !== undefined;", field.Desc.Number())
+			p.F("return "+p.JSPB("Message")+".getField(this, %d) !== undefined;", field.Desc.Number())
 		})
-		p.P("}")
-		p.P(prototype.Set(field.Desc), "(value: ", prototype.Type(field.Desc), "): ", field.Parent.Desc.Name(), " {")
+		p.End("}")
+		p.Begin(" {", prototype.Set(field.Desc), "(value", p.T(": "+prototype.Type(field.Desc)), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
 			if field.Desc.Kind() == protoreflect.MessageKind {
-				p.F("jspb.Message.setOneofWrapperField(this, %d, __%s_oneof[%d], value);", field.Desc.Number(), field.Parent.Desc.Name(), field.Desc.ContainingOneof().Index())
+				p.F(p.JSPB("Message")+".setOneofWrapperField(this, %d, __%s_oneof[%d], value);", field.Desc.Number(), prototype.LocalName(field.Parent.Desc), field.Desc.ContainingOneof().Index())
 			} else {
-				p.F("jspb.Message.setOneofField(this, %d, __%s_oneof[%d], value);", field.Desc.Number(), field.Parent.Desc.Name(), field.Desc.ContainingOneof().Index())
+				p.F(p.JSPB("Message")+".setOneofField(this, %d, __%s_oneof[%d], value);", field.Desc.Number(), prototype.LocalName(field.Parent.Desc), field.Desc.ContainingOneof().Index())
 			}
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setOneofField(this, %d, __%s_oneof[%d], undefined);", field.Desc.Number(), field.Parent.Desc.Name(), field.Desc.ContainingOneof().Index())
+			p.F(p.JSPB("Message")+".setOneofField(this, %d, __%s_oneof[%d], undefined);", field.Desc.Number(), prototype.LocalName(field.Parent.Desc), field.Desc.ContainingOneof().Index())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
 		return
 	}
 	if field.Desc.IsMap() {
 		// map field
-		p.P(prototype.Get(field.Desc), "(): jspb.Map<", prototype.Type(field.Desc.MapKey()), ", ", prototype.Type(field.Desc.MapValue()), "> {")
+		p.Begin(" {", prototype.Get(field.Desc), "()", p.T(": "+p.JSPB("Map")+"<"+prototype.Type(field.Desc.MapKey())+", "+prototype.Type(field.Desc.MapValue())+">"))
 		p.Indented(func() {
 			// Note that getMapField returns undefined only, if noLazyCreate is true.
-			p.P("// @ts-ignore: Ignore that getMapField might return undefined")
-			p.F("return jspb.Message.getMapField(this, %d, false, %s);", field.Desc.Number(), prototype.Ctor(field.Desc.MapValue()))
+			p.Types(func() {
+				p.P("// @ts-ignore: Ignore that getMapField might return undefined")
+			})
+			p.F("return "+p.JSPB("Message")+".getMapField(this, %d, false, %s);", field.Desc.Number(), prototype.Ctor(field.Desc.MapValue()))
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
 			p.P("this.", prototype.Get(field.Desc), "().clear();")
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
 		return
 	}
 	if field.Desc.IsList() && field.Desc.Kind() == protoreflect.MessageKind {
 		// Generate getter, setter and clearer for repeated, wrapper fields.
 		// repeated, non-wrapper field
-		p.P(prototype.Get(field.Desc), "(): Array<", prototype.Type(field.Desc), "> {")
+		p.Begin(" {", prototype.Get(field.Desc), "()", p.T(": Array<"+prototype.Type(field.Desc)+">"))
 		p.Indented(func() {
-			p.F("return jspb.Message.getRepeatedWrapperField(this, %s, %d);", prototype.Ctor(field.Desc), field.Desc.Number())
+			p.F("return "+p.JSPB("Message")+".getRepeatedWrapperField(this, %s, %d);", prototype.Ctor(field.Desc), field.Desc.Number())
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Set(field.Desc), "(value: Array<", prototype.Type(field.Desc), ">): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Set(field.Desc), "(value", p.T(": Array<"+prototype.Type(field.Desc)+">"), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setRepeatedWrapperField(this, %d, value);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setRepeatedWrapperField(this, %d, value);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Add(field.Desc), "(value: ", prototype.Type(field.Desc), ", index?: number): ", field.Parent.Desc.Name(), "{")
+		p.Begin("{", prototype.Add(field.Desc), "(value", p.T(": "+prototype.Type(field.Desc)), ", index", p.T("?: number"), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.addToRepeatedWrapperField(this, %d, value, %s, index);", field.Desc.Number(), prototype.Ctor(field.Desc))
+			p.F(p.JSPB("Message")+".addToRepeatedWrapperField(this, %d, value, %s, index);", field.Desc.Number(), prototype.Ctor(field.Desc))
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setRepeatedWrapperField(this, %d, undefined);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setRepeatedWrapperField(this, %d, undefined);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
 		return
 	}
 	if field.Desc.IsList() {
 		// repeated, non-wrapper field
-		p.P(prototype.Get(field.Desc), "(): Array<", prototype.Type(field.Desc), "> {")
+		p.Begin(" {", prototype.Get(field.Desc), "()", p.T(": Array<"+prototype.Type(field.Desc)+">"))
 		p.Indented(func() {
-			p.F("return jspb.Message.getField(this, %d) as Array<%s>;", field.Desc.Number(), prototype.Type(field.Desc))
+			p.P("return ", p.JSPB("Message"), ".getField(this, ", field.Desc.Number(), ")", p.T(" as Array<"+prototype.Type(field.Desc)+">"), ";")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Set(field.Desc), "(value: Array<", prototype.Type(field.Desc), ">): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Set(field.Desc), "(value", p.T(": Array<"+prototype.Type(field.Desc)+">"), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setField(this, %d, value);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setField(this, %d, value);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Add(field.Desc), "(value: ", prototype.Type(field.Desc), ", index?: number): ", field.Parent.Desc.Name(), "{")
+		p.Begin("{", prototype.Add(field.Desc), "(value", p.T(": "+prototype.Type(field.Desc)), ", index", p.T("?: number"), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.addToRepeatedField(this, %d, value, index);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".addToRepeatedField(this, %d, value, index);", field.Desc.Number())
 			p.P("return this;")
 
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setField(this, %d, undefined);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setField(this, %d, undefined);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
 		return
 	}
 	if field.Desc.Kind() == protoreflect.MessageKind {
 		// non-repeated, wrapper field
-		p.P(prototype.Get(field.Desc), "(): ", prototype.Type(field.Desc), " {")
+		p.Begin(" {", prototype.Get(field.Desc), "()", p.T(": "+prototype.Type(field.Desc)))
 		p.Indented(func() {
-			p.F("return jspb.Message.getWrapperField(this, %s, %d);", prototype.Type(field.Desc), field.Desc.Number())
+			p.F("return "+p.JSPB("Message")+".getWrapperField(this, %s, %d);", prototype.Type(field.Desc), field.Desc.Number())
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Set(field.Desc), "(value: ", prototype.Type(field.Desc), "): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Set(field.Desc), "(value", p.T(": "+prototype.Type(field.Desc)), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setWrapperField(this, %d, value);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setWrapperField(this, %d, value);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
-		p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+		p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 		p.Indented(func() {
-			p.F("jspb.Message.setField(this, %d, undefined);", field.Desc.Number())
+			p.F(p.JSPB("Message")+".setField(this, %d, undefined);", field.Desc.Number())
 			p.P("return this;")
 		})
-		p.P("}")
+		p.End("}")
 		p.P()
 		return
 	}
 	// non-repeated, non-wrapper field
-	p.P(prototype.Get(field.Desc), "(): ", prototype.Type(field.Desc), "{")
+	p.Begin("{", prototype.Get(field.Desc), "()", p.T(": "+prototype.Type(field.Desc)))
 	p.Indented(func() {
-		p.F("return jspb.Message.getFieldWithDefault(this, %d, %s);", field.Desc.Number(), prototype.Default(field.Desc))
+		p.F("return "+p.JSPB("Message")+".getFieldWithDefault(this, %d, %s);", field.Desc.Number(), prototype.Default(field.Desc))
 	})
-	p.P("}")
+	p.End("}")
 	p.P()
-	p.P(prototype.Set(field.Desc), "(value: ", prototype.Type(field.Desc), "): ", field.Parent.Desc.Name(), " {")
+	p.Begin(" {", prototype.Set(field.Desc), "(value", p.T(": "+prototype.Type(field.Desc)), ")", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 	p.Indented(func() {
-		p.F("jspb.Message.setField(this, %d, value);", field.Desc.Number())
+		p.F(p.JSPB("Message")+".setField(this, %d, value);", field.Desc.Number())
 		p.P("return this;")
 	})
-	p.P("}")
+	p.End("}")
 	p.P()
-	p.P(prototype.Clear(field.Desc), "(): ", field.Parent.Desc.Name(), " {")
+	p.Begin(" {", prototype.Clear(field.Desc), "()", p.T(": "+prototype.LocalName(field.Parent.Desc)))
 	p.Indented(func() {
-		p.F("jspb.Message.setField(this, %d, undefined);", field.Desc.Number())
+		p.F(p.JSPB("Message")+".setField(this, %d, undefined);", field.Desc.Number())
 		p.P("return this;")
 	})
-	p.P("}")
-	p.P()
-}
-
-func genService(gen *protogen.Plugin, file *protogen.File, p *Printer, svc *protogen.Service) {
-	p.P("export class ", svc.Desc.Name(), "Client {")
-	p.P()
-	p.Indent()
-	p.P("private client: grpcweb.GrpcWebClientBase;")
-	p.P("private hostname: string;")
-	p.P()
-
-	// Constructor
-	p.P("constructor(hostname: string, options: grpcweb.GrpcWebClientBaseOptions) {")
-	p.Indented(func() {
-		p.P("this.hostname = hostname;")
-		p.P("this.client = new grpcweb.GrpcWebClientBase(options);")
-	})
-	p.P("}") // constructor end
+	p.End("}")
 	p.P()
-
-	// Generate method definitions.
-	for _, method := range svc.Methods {
-		p.P(strcase.ToLowerCamel(string(method.Desc.Name())), "(")
-		p.Indented(func() {
-			p.P("request: ", prototype.InputType(method.Desc), ",")
-			p.P("metadata: grpcweb.Metadata,")
-			p.P("callback: (err: grpcweb.Error, response: ", prototype.OutputType(method.Desc), ") => void")
-		})
-		p.P("): grpcweb.ClientReadableStream<", prototype.OutputType(method.Desc), "> {")
-		p.Indented(func() {
-			p.P("return this.client.rpcCall(")
-			p.Indented(func() {
-				p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
-				p.P("request,")
-				p.P("metadata,")
-				p.P(methodDescriptorName(method), ",")
-				p.P("callback")
-			})
-			p.P(")")
-		})
-		p.P("}") // method end
-		p.P()
-	}
-
-	p.Outdent()
-	p.P("}") // service class end
-
-	// Generate method descriptor and info.
-	for _, method := range svc.Methods {
-		p.P("const ", methodDescriptorName(method), " = new grpcweb.MethodDescriptor<")
-		p.Indented(func() {
-			p.P(prototype.InputType(method.Desc), ", ")
-			p.P(prototype.OutputType(method.Desc))
-		})
-		p.P(">(")
-		p.Indented(func() {
-			p.F("\"%s\",", prototype.Address(method.Desc))
-			p.F("\"%s\",", prototype.MethodType(method.Desc))
-			p.P(prototype.InputType(method.Desc), ",")
-			p.P(prototype.OutputType(method.Desc), ",")
-			p.P("(req: ", prototype.InputType(method.Desc), ") => req.serializeBinary(),")
-			p.P(prototype.OutputType(method.Desc), ".deserializeBinary")
-		})
-		p.P(");")
-		p.P()
-		// Generate method info.
-		p.P("const ", methodInfoName(method), " = new grpcweb.AbstractClientBase.MethodInfo<")
-		p.Indented(func() {
-			p.P(prototype.InputType(method.Desc), ", ")
-			p.P(prototype.OutputType(method.Desc))
-		})
-		p.P(">(")
-		p.Indented(func() {
-			p.P(prototype.OutputType(method.Desc), ",")
-			p.P("(req: ", prototype.InputType(method.Desc), ") => req.serializeBinary(),")
-			p.P(prototype.OutputType(method.Desc), ".deserializeBinary")
-		})
-		p.P(");")
-		p.P()
-	}
-}
-
-func methodInfoName(m *protogen.Method) string {
-	return "methodInfo_" + string(m.Desc.Parent().Name()) + "_" + string(m.Desc.Name())
-}
-
-func methodDescriptorName(m *protogen.Method) string {
-	return "methodDescriptor_" + string(m.Desc.Parent().Name()) + "_" + string(m.Desc.Name())
 }
 
 func toArray(arr []int32) string {
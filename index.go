@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Values of the index parameter.
+//
+// Index files re-export all declarations of the files they index. A name that
+// is exported by more than one of these files is re-exported under an alias
+// derived from the path of each file instead, e.g. Money of "x/v1/money_pb.ts"
+// as x_v1_money_pb_Money, and a warning is emitted.
+const (
+	// indexDirectory generates an index file per output directory.
+	indexDirectory = "directory"
+
+	// indexPackage generates an index file per proto package, e.g. for the
+	// package "mycom.protobuf" at "mycom/protobuf/index.ts".
+	indexPackage = "package"
+)
+
+// indexedFile is a generated file that is re-exported by an index file.
+type indexedFile struct {
+	// Path is the path of the generated file, see prototype.Path.
+	Path string
+
+	// Package is the proto package of the file the generated file was
+	// generated for.
+	Package protoreflect.FullName
+
+	// Exports are the top level declarations exported by the generated file.
+	Exports []export
+}
+
+// genIndexes generates the index files that re-export the declarations of
+// files.
+func genIndexes(gen *protogen.Plugin, files []indexedFile, params parameter) {
+	byIndex := make(map[string][]indexedFile)
+	for _, f := range files {
+		path := indexPath(f, params)
+		byIndex[path] = append(byIndex[path], f)
+	}
+	var paths []string
+	for path := range byIndex {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		genIndex(gen, path, byIndex[path], params)
+	}
+}
+
+// indexPath returns the path of the index file that re-exports f.
+func indexPath(f indexedFile, params parameter) string {
+	if params.Index == indexPackage {
+		if f.Package == "" {
+			return "index.ts"
+		}
+		return strings.Replace(string(f.Package), ".", "/", -1) + "/index.ts"
+	}
+	return path.Join(path.Dir(f.Path), "index.ts")
+}
+
+// genIndex generates the index file at indexPath, that re-exports the
+// declarations of files.
+//
+// Declarations that are exported by more than one of files are re-exported
+// under aliases, see indexAlias, since the re-exports would be ambiguous
+// otherwise. A warning is emitted for each of them.
+func genIndex(gen *protogen.Plugin, indexPath string, files []indexedFile, params parameter) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	// Record the files that export a name, to detect clashes.
+	exporters := make(map[string][]string)
+	for _, f := range files {
+		for _, e := range f.Exports {
+			exporters[e.Name] = append(exporters[e.Name], f.Path)
+		}
+	}
+
+	aliases := indexAliases(files, exporters)
+	for _, p := range newPrinters(gen, indexPath, nil, params) {
+		genIndexFile(p, indexPath, files, aliases)
+	}
+
+	var clashes []string
+	for name, paths := range exporters {
+		if len(paths) > 1 {
+			clashes = append(clashes, name)
+		}
+	}
+	sort.Strings(clashes)
+	for _, name := range clashes {
+		var as []string
+		for _, path := range exporters[name] {
+			as = append(as, aliases[path][name])
+		}
+		warn("%s: %s is exported by %s and is therefore re-exported as %s", indexPath, name, strings.Join(exporters[name], " and "), strings.Join(as, " and "))
+	}
+}
+
+// indexAliases returns the aliases of the declarations of files that are
+// exported by more than one file according to exporters, by the path of the
+// file and the declaration name.
+func indexAliases(files []indexedFile, exporters map[string][]string) map[string]map[string]string {
+	aliases := make(map[string]map[string]string)
+	for _, f := range files {
+		aliases[f.Path] = make(map[string]string)
+		for _, e := range f.Exports {
+			if len(exporters[e.Name]) < 2 {
+				continue
+			}
+			alias := indexAlias(f.Path, e.Name)
+			// The alias might be exported under its own name, too.
+			for i := 2; len(exporters[alias]) > 0; i++ {
+				alias = fmt.Sprintf("%s%d", indexAlias(f.Path, e.Name), i)
+			}
+			aliases[f.Path][e.Name] = alias
+		}
+	}
+	return aliases
+}
+
+// indexAlias returns the alias of the declaration name of the generated file
+// at path, e.g. "x_v1_money_pb_Money" for Money of "x/v1/money_pb.ts".
+func indexAlias(path, name string) string {
+	alias := strings.Map(func(r rune) rune {
+		if r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(path, ".ts"))
+	if alias != "" && unicode.IsDigit(rune(alias[0])) {
+		alias = "_" + alias
+	}
+	return alias + "_" + name
+}
+
+// genIndexFile generates the re-exports of files, under the aliases given by
+// the path of the file and the declaration name, if any.
+func genIndexFile(p *Printer, indexPath string, files []indexedFile, aliases map[string]map[string]string) {
+	p.P("// Code generated by protoc-gen-ts. DO NOT EDIT.")
+	p.P("// versions:")
+	p.P("// 	protoc-gen-go ", "v0.0.1-devel")
+	p.P()
+
+	for _, f := range files {
+		var values, types []string
+		for _, e := range f.Exports {
+			name := e.Name
+			if alias, ok := aliases[f.Path][e.Name]; ok {
+				name += " as " + alias
+			}
+			if e.TypeOnly {
+				types = append(types, name)
+			} else {
+				values = append(values, name)
+			}
+		}
+		mod := prototype.RelativeImport(path.Dir(indexPath), strings.TrimSuffix(f.Path, ".ts"))
+		if len(values) > 0 {
+			p.P("export { ", strings.Join(values, ", "), " } from \"", mod, "\";")
+		}
+		if len(types) > 0 {
+			p.Types(func() {
+				p.P("export type { ", strings.Join(types, ", "), " } from \"", mod, "\";")
+			})
+		}
+	}
+}
@@ -252,6 +252,39 @@ func Ctor(desc protoreflect.FieldDescriptor) string {
 	return "undefined"
 }
 
+// Kind returns the name of the proto kind of desc as used by the runtime field
+// metadata, e.g. "int32", "string", "message" or "enum".
+//
+// For maps, the kind of the map values is returned.
+func Kind(desc protoreflect.FieldDescriptor) string {
+	if desc.IsMap() {
+		return desc.MapValue().Kind().String()
+	}
+	return desc.Kind().String()
+}
+
+// Label returns "optional", "required" or "repeated" for desc. Note that maps
+// are repeated.
+func Label(desc protoreflect.FieldDescriptor) string {
+	return desc.Cardinality().String()
+}
+
+// Ref returns the Enum respec. Message name (in context) that desc refers to.
+//
+// For maps, the Enum respec. Message name of the map values is returned. For
+// primitive types, "" is returned.
+func Ref(desc protoreflect.FieldDescriptor) string {
+	if desc.IsMap() {
+		desc = desc.MapValue()
+	}
+	switch desc.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind, protoreflect.EnumKind:
+		return Type(desc)
+	default:
+		return ""
+	}
+}
+
 // BinaryReaderFunc returns the name of the function that should be called on
 // the jspb.BinaryReader class to read the field described by desc.
 func BinaryReaderFunc(desc protoreflect.FieldDescriptor) string {
@@ -1,6 +1,7 @@
 package prototype
 
 import (
+	"fmt"
 	"path"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,33 @@ import (
 // WellKnownPath is the import prefix that is used for well known types.
 var WellKnownPath = "google-protobuf/google/protobuf"
 
+// GenerateWellKnownTypes controls whether well known types are generated by
+// protoc-gen-ts instead of being imported from WellKnownPath.
+//
+// If set, imports of well known types are treated like any other local import,
+// e.g. "google/protobuf/timestamp.proto" imported from "mycom/hello.proto"
+// becomes
+//
+// 	"../google/protobuf/timestamp_pb"
+//
+var GenerateWellKnownTypes = false
+
+// ImportSuffix is appended to import paths that refer to files rather than
+// packages, e.g. ".js" to match the resolution of native ES modules.
+//
+// It is not appended to modules that proto files are mapped to explicitly by
+// Mappings.Files.
+var ImportSuffix = ""
+
+// Flatten controls whether nested messages and enums are declared at the top
+// level of the generated file instead of in the namespace of their parent
+// message.
+//
+// Flattened names concat the names of the parent messages with "_", e.g. the
+// message "Inner" nested in "Outer" is declared as "Outer_Inner" and its
+// AsObject type as "Outer_InnerAsObject".
+var Flatten = false
+
 // Import is a typescript import.
 type Import struct {
 	// The Typescript import path.
@@ -37,59 +65,165 @@ type Import struct {
 	Alias string
 }
 
-// Imports returns the list of Import's that are present in desc.
-func Imports(desc protoreflect.FileDescriptor) []*Import {
+// PublicImports returns the list of Import's of the files that desc imports
+// publicly. The Typescript file generated for desc re-exports these.
+func PublicImports(desc protoreflect.FileDescriptor) []*Import {
 	var ii []*Import
 	for i := 0; i < desc.Imports().Len(); i++ {
-		ii = append(ii, newImport(desc, desc.Imports().Get(i)))
+		if imp := desc.Imports().Get(i); imp.IsPublic {
+			ii = append(ii, ImportFrom(Path(desc), desc, imp))
+		}
 	}
 	return ii
 }
 
-func newImport(base protoreflect.FileDescriptor, imp protoreflect.FileImport) *Import {
+// Exporter returns the file that the Typescript files generated for ctx import
+// the declarations of def from. That is def itself, if ctx imports it, or
+// else the file imported by ctx that re-exports def, since def is reached
+// through a chain of public imports. The latter need not be generated next to
+// def, e.g. if it is mapped to another module.
+func Exporter(ctx, def protoreflect.FileDescriptor) protoreflect.FileDescriptor {
+	imports := ctx.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if imports.Get(i).Path() == def.Path() {
+			return def
+		}
+	}
+	for i := 0; i < imports.Len(); i++ {
+		if imp := imports.Get(i); reexports(imp, def) {
+			return imp.FileDescriptor
+		}
+	}
+	return def
+}
+
+// reexports reports whether the Typescript file generated for desc re-exports
+// the declarations of def, i.e. whether desc imports def publicly,
+// transitively.
+func reexports(desc, def protoreflect.FileDescriptor) bool {
+	imports := desc.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		imp := imports.Get(i)
+		if imp.IsPublic && (imp.Path() == def.Path() || reexports(imp, def)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportFrom returns the Import of imp into the Typescript file at path from,
+// that is generated for desc.
+//
+// Usually, from is Path(desc), but files other than that might be generated for
+// desc as well, e.g. a separate file for services.
+func ImportFrom(from string, desc protoreflect.FileDescriptor, imp protoreflect.FileDescriptor) *Import {
 	return &Import{
-		Path:  importPath(base, imp),
-		Alias: importAlias(imp),
+		Path:  ImportPath(from, desc, imp),
+		Alias: ImportAlias(imp),
 	}
 }
 
+// RuntimePath is the path of the runtime support file that protoc-gen-ts
+// generates alongside the files that make use of it.
+const RuntimePath = "protoc-gen-ts/runtime.ts"
+
+// Values for Paths.
+const (
+	// PathsSourceRelative places generated files in the same relative
+	// directory as the proto file, e.g. "mycom/protobuf/hello.proto" is
+	// generated to "mycom/protobuf/hello_pb.ts".
+	PathsSourceRelative = "source_relative"
+
+	// PathsImport places generated files at the module that the proto file
+	// is mapped to by Mappings, e.g. if "mycom/protobuf/hello.proto" is
+	// mapped to "@mycom/protos/hello_pb", it is generated to
+	// "@mycom/protos/hello_pb.ts". Files that are not mapped to a
+	// non-relative module are placed like with PathsSourceRelative.
+	PathsImport = "import"
+
+	// PathsPackage places generated files in a directory named after the
+	// proto package, e.g. "protos/hello.proto" with package
+	// "mycom.protobuf" is generated to "mycom/protobuf/hello_pb.ts".
+	PathsPackage = "package"
+)
+
+// Paths controls where the generated files are placed in the output tree. It
+// is one of PathsSourceRelative, PathsImport or PathsPackage.
+var Paths = PathsSourceRelative
+
 // Path returns the path of the typescript fule that protoc-gen-ts would
 // generate for desc.
 //
 // It replaces ".proto" suffix, if present, with "_pb.ts". If no ".proto" suffix
-// is present, path is returned.
+// is present, path is returned. The directory of the returned path is
+// determined by Paths.
 func Path(desc protoreflect.FileDescriptor) string {
+	switch Paths {
+	case PathsImport:
+		if mod, ok := Mappings.Module(desc); ok && !strings.HasPrefix(mod, ".") {
+			return strings.TrimSuffix(mod, ImportSuffix) + ".ts"
+		}
+	case PathsPackage:
+		base := strings.TrimSuffix(path.Base(desc.Path()), ".proto") + "_pb.ts"
+		if desc.Package() == "" {
+			return base
+		}
+		return strings.Replace(string(desc.Package()), ".", "/", -1) + "/" + base
+	}
 	name := strings.TrimSuffix(desc.Path(), ".proto") + "_pb.ts"
 	return name
 }
 
-// importPath constructs the Typescript import path.
+// IsWellKnown reports whether desc is one of the well known types files, i.e.
+// a file in the "google.protobuf" package.
+func IsWellKnown(desc protoreflect.FileDescriptor) bool {
+	return desc.Package() == "google.protobuf"
+}
+
+// ImportPath constructs the Typescript import path of imp into the Typescript
+// file at path from, that is generated for desc.
 //
-// For well known types, eg.: "google/protobuf/timestamp.proto", importPath
+// For well known types, eg.: "google/protobuf/timestamp.proto", ImportPath
 // returns
 //
 // 	"google-protobuf/google/protobuf/timestamp_pb"
 //
-// For local, e.g. a file "mycom/protobuf/hello.proto", tmporPath returns
+// For local, e.g. a file "mycom/protobuf/hello.proto", ImportPath returns
 //
 // 	"./mycom/protobuf/hello_pb"
 //
-func importPath(desc protoreflect.FileDescriptor, imp protoreflect.FileImport) string {
-	if imp.Package() == "google.protobuf" && desc.Package() != "google.protobuf" {
+// Imports that are mapped by Mappings are imported from the mapped module
+// instead. Local imports are relative to the generated files, see Path.
+func ImportPath(from string, desc protoreflect.FileDescriptor, imp protoreflect.FileDescriptor) string {
+	if mod, ok := Mappings.Module(imp); ok {
+		return mod
+	}
+	if !GenerateWellKnownTypes && IsWellKnown(imp) && !IsWellKnown(desc) {
 		fileName := filepath.Base(imp.Path())
 		fileNamePb := strings.TrimSuffix(fileName, ".proto") + "_pb"
-		return WellKnownPath + "/" + fileNamePb
+		return WellKnownPath + "/" + fileNamePb + ImportSuffix
 	}
-	base := path.Dir(desc.Path())
-	relpath, err := filepath.Rel(base, imp.Path())
+	base := path.Dir(from)
+	return RelativeImport(base, strings.TrimSuffix(Path(imp), ".ts"))
+}
+
+// RuntimeImportPath returns the import path of the runtime support file (see
+// RuntimePath) for the Typescript file generated for desc.
+func RuntimeImportPath(desc protoreflect.FileDescriptor) string {
+	return RelativeImport(path.Dir(Path(desc)), strings.TrimSuffix(RuntimePath, ".ts"))
+}
+
+// RelativeImport returns the relative import path of the module target, as
+// seen from the directory base. Both are paths in the output tree.
+func RelativeImport(base, target string) string {
+	relpath, err := filepath.Rel(base, target)
 	if err != nil {
 		panic(err)
 	}
-	path := strings.TrimSuffix(relpath, ".proto") + "_pb"
-	if !strings.HasPrefix(path, ".") {
-		path = "./" + path
+	if !strings.HasPrefix(relpath, ".") {
+		relpath = "./" + relpath
 	}
-	return path
+	return relpath + ImportSuffix
 }
 
 // ImportAlias returns the import name for desc.
@@ -100,7 +234,10 @@ func importPath(desc protoreflect.FileDescriptor, imp protoreflect.FileImport) s
 // 	import "google/protobuf/timestamp.proto"
 //
 // ImportAlias returns "google_protobuf_timestamp_pb".
-func importAlias(desc protoreflect.FileDescriptor) string {
+//
+// The alias is a proposal only, since the aliases of two files might collide,
+// e.g. for "a/v1/common.proto" and "b/v1/common.proto" of the same package.
+func ImportAlias(desc protoreflect.FileDescriptor) string {
 	// TODO: pkg might have a leading dot?
 	pkg := string(desc.Package())
 	base := path.Base(desc.Path())
@@ -109,6 +246,54 @@ func importAlias(desc protoreflect.FileDescriptor) string {
 	return alias
 }
 
+// PathAlias returns an import name for desc that is derived from its path,
+// e.g. "b_v1_common_pb" for "b/v1/common.proto". It is used if the alias
+// returned by ImportAlias is taken.
+func PathAlias(desc protoreflect.FileDescriptor) string {
+	name := strings.TrimSuffix(desc.Path(), ".proto") + "_pb"
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Ident is a Typescript identifier that is exported by the Typescript file
+// generated for File or, if File is nil, by Module. It is the Typescript
+// counterpart to protogen.GoIdent.
+type Ident struct {
+	File   protoreflect.FileDescriptor
+	Module Module
+	Name   string
+}
+
+// Module is a module that the generated files import, that is not generated
+// for a proto file. Its value is the alias it is imported as.
+type Module string
+
+// Modules that are not generated for proto files.
+const (
+	// ModuleJSPB is the npm package "google-protobuf".
+	ModuleJSPB Module = "jspb"
+
+	// ModuleGRPCWeb is the npm package "grpc-web".
+	ModuleGRPCWeb Module = "grpcweb"
+
+	// ModuleRuntime is the runtime support file, see RuntimePath.
+	ModuleRuntime Module = "runtime"
+)
+
+// Qualifier qualifies identifiers that are declared in other files than the
+// one being generated, e.g. by the alias the declaring file is imported as.
+type Qualifier interface {
+	QualifiedIdent(ident Ident) string
+}
+
+// Qualify is the Qualifier for the file being generated. It must be set before
+// any name of a declaration in another file is requested.
+var Qualify Qualifier
+
 func NameInContext(ctx protoreflect.FileDescriptor, msg protoreflect.MessageDescriptor) string {
 	return nameInContext(ctx, msg)
 }
@@ -120,11 +305,10 @@ func NameInContext(ctx protoreflect.FileDescriptor, msg protoreflect.MessageDesc
 // name of msg prefix with the import alias for file that defines msg is returned.
 func nameInContext(ctx protoreflect.FileDescriptor, msg protoreflect.MessageDescriptor) string {
 	if ctx.Path() != msg.ParentFile().Path() {
-		alias := importAlias(msg.ParentFile())
-		return alias + "." + trimPackagePrefix(msg)
+		return QualifiedName(msg)
 	}
 	// If msg is defined in ctx, do not prefix with import alias.
-	return trimPackagePrefix(msg)
+	return fileLocalName(msg)
 }
 
 // enumInContext returns the Enum name for enum in context ctx.
@@ -134,11 +318,111 @@ func nameInContext(ctx protoreflect.FileDescriptor, msg protoreflect.MessageDesc
 // enum prefix with the import alias for file that defines enum is returned.
 func enumNameInContext(ctx protoreflect.FileDescriptor, enum protoreflect.EnumDescriptor) string {
 	if ctx.Path() != enum.ParentFile().Path() {
-		alias := importAlias(enum.ParentFile())
-		return alias + "." + trimPackagePrefix(enum)
+		return Qualify.QualifiedIdent(Ident{File: enum.ParentFile(), Name: fileLocalName(enum)})
 	}
 	// If enum is defined in ctx, do not prefix with import alias.
-	return trimPackagePrefix(enum)
+	return fileLocalName(enum)
+}
+
+// LocalName returns the name that the Message or Enum desc is declared with.
+//
+// Nested messages and enums are declared in the namespace of their parent
+// message, thus the short name of desc is returned. If the nested
+// declarations of its file are Flattened, the flattened name of desc is
+// returned, e.g. "Outer_Inner".
+func LocalName(desc protoreflect.Descriptor) string {
+	if Flattened(desc.ParentFile()) {
+		return fileLocalName(desc)
+	}
+	return string(desc.Name())
+}
+
+// AsObject returns the name of the AsObject type of msg in context ctx, e.g.
+// "Outer.Inner.AsObject" or, if Flatten is set, "Outer_InnerAsObject".
+func AsObject(ctx protoreflect.FileDescriptor, msg protoreflect.MessageDescriptor) string {
+	if Flattened(msg.ParentFile()) {
+		return nameInContext(ctx, msg) + "AsObject"
+	}
+	return nameInContext(ctx, msg) + ".AsObject"
+}
+
+// LocalAsObject returns the name of the AsObject type of msg as seen from the
+// declaration of msg, e.g. "Inner.AsObject" or, if Flatten is set,
+// "Outer_InnerAsObject".
+func LocalAsObject(msg protoreflect.MessageDescriptor) string {
+	if Flattened(msg.ParentFile()) {
+		return LocalName(msg) + "AsObject"
+	}
+	return LocalName(msg) + ".AsObject"
+}
+
+// Flattened reports whether the nested declarations of desc are flattened.
+//
+// This is never the case for well known types, unless GenerateWellKnownTypes
+// is set, since the files importing them expect the namespaces of the files
+// at WellKnownPath. It holds for the declarations in desc as well as for the
+// references to them.
+func Flattened(desc protoreflect.FileDescriptor) bool {
+	return Flatten && (GenerateWellKnownTypes || !IsWellKnown(desc))
+}
+
+// CheckFlattened returns an error if two of the declarations of desc are
+// generated with the same name, because their nested declarations are
+// flattened. E.g. the nested message "Outer.Inner" and the message
+// "Outer_Inner" are both declared as "Outer_Inner", and the message
+// "OuterAsObject" clashes with the AsObject type of the message "Outer".
+func CheckFlattened(desc protoreflect.FileDescriptor) error {
+	if !Flattened(desc) {
+		return nil
+	}
+	declared := make(map[string]string)
+	declare := func(name, decl string) error {
+		if other, ok := declared[name]; ok {
+			return fmt.Errorf("%s: %s and %s are both declared as %s, since nested declarations are flattened; rename one of them", desc.Path(), other, decl, name)
+		}
+		declared[name] = decl
+		return nil
+	}
+	var walk func(enums protoreflect.EnumDescriptors, msgs protoreflect.MessageDescriptors) error
+	walk = func(enums protoreflect.EnumDescriptors, msgs protoreflect.MessageDescriptors) error {
+		for i := 0; i < enums.Len(); i++ {
+			enum := enums.Get(i)
+			if err := declare(fileLocalName(enum), "enum "+string(enum.FullName())); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < msgs.Len(); i++ {
+			msg := msgs.Get(i)
+			if err := declare(fileLocalName(msg), "message "+string(msg.FullName())); err != nil {
+				return err
+			}
+			if err := declare(LocalAsObject(msg), "the AsObject type of message "+string(msg.FullName())); err != nil {
+				return err
+			}
+			if err := walk(msg.Enums(), msg.Messages()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(desc.Enums(), desc.Messages())
+}
+
+// fileLocalName returns the name of the Message or Enum desc as seen from the
+// top level of the file that defines desc, e.g. "Outer.Inner" respec. with
+// Flatten set "Outer_Inner".
+func fileLocalName(desc protoreflect.Descriptor) string {
+	name := trimPackagePrefix(desc)
+	if Flattened(desc.ParentFile()) {
+		return strings.Replace(name, ".", "_", -1)
+	}
+	return name
+}
+
+// QualifiedName returns the Message name for msg qualified by Qualify, as seen
+// from any file other than the one generated for the file that defines msg.
+func QualifiedName(msg protoreflect.MessageDescriptor) string {
+	return Qualify.QualifiedIdent(Ident{File: msg.ParentFile(), Name: fileLocalName(msg)})
 }
 
 // trimPackagePrefix returns the full name for desc with the package prefix
@@ -0,0 +1,66 @@
+package prototype
+
+import (
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ImportMap maps proto files to the Typescript modules they are imported
+// from. Imports of files that are not mapped fall back to relative import
+// paths respec. to WellKnownPath for well known types.
+type ImportMap struct {
+	// Files maps proto file paths to modules, e.g.
+	//
+	// 	"common/v1/money.proto" -> "@acme/common-protos/v1/money_pb"
+	//
+	Files map[string]string
+
+	// Prefixes maps proto path prefixes to module prefixes. The remainder of
+	// the proto path is appended to the module prefix, e.g. with
+	//
+	// 	"common/" -> "@acme/common-protos/"
+	//
+	// "common/v1/money.proto" maps to "@acme/common-protos/v1/money_pb".
+	Prefixes map[string]string
+
+	// Packages maps proto packages to module directories. The base name of
+	// the proto file is appended to the module directory, e.g. with
+	//
+	// 	"common.v1" -> "@acme/common-protos/v1"
+	//
+	// "common/v1/money.proto" maps to "@acme/common-protos/v1/money_pb".
+	Packages map[string]string
+}
+
+// Mappings is the ImportMap that is consulted for every import.
+var Mappings ImportMap
+
+// Module returns the module that desc is mapped to by m and whether there is
+// a mapping for desc at all.
+//
+// Mappings in Files take precedence over mappings in Prefixes, where the
+// longest matching prefix wins. Mappings in Packages are considered last.
+//
+// ImportSuffix is appended to modules derived from Prefixes and Packages.
+func (m ImportMap) Module(desc protoreflect.FileDescriptor) (string, bool) {
+	if mod, ok := m.Files[desc.Path()]; ok {
+		return mod, true
+	}
+	longest := ""
+	for prefix := range m.Prefixes {
+		if strings.HasPrefix(desc.Path(), prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest != "" {
+		rest := strings.TrimPrefix(desc.Path(), longest)
+		return m.Prefixes[longest] + strings.TrimSuffix(rest, ".proto") + "_pb" + ImportSuffix, true
+	}
+	if dir, ok := m.Packages[string(desc.Package())]; ok {
+		base := strings.TrimSuffix(path.Base(desc.Path()), ".proto") + "_pb"
+		return strings.TrimSuffix(dir, "/") + "/" + base + ImportSuffix, true
+	}
+	return "", false
+}
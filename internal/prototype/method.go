@@ -40,13 +40,51 @@ func Address(desc protoreflect.MethodDescriptor) string {
 // MetMethodType returns "server_streaming" or "unary".
 //
 // Panics if desc.IsStreamingClient evaluates to true, because GRPC web does not
-// support client side streaming.
+// support client side streaming. Such methods must be filtered by IsSupported.
 func MethodType(desc protoreflect.MethodDescriptor) string {
+	if desc.IsStreamingClient() {
+		panic(fmt.Sprintf("Client side streaming method (%s) is not supported", desc.FullName()))
+	}
 	if desc.IsStreamingServer() {
 		return "server_streaming"
 	}
-	if desc.IsStreamingClient() {
-		panic(fmt.Sprintf("Client side streaming method (%s) is not supported", desc.FullName()))
+	return "unary"
+}
+
+// StreamingKind returns "unary", "server_streaming", "client_streaming" or
+// "bidi_streaming".
+func StreamingKind(desc protoreflect.MethodDescriptor) string {
+	switch {
+	case desc.IsStreamingClient() && desc.IsStreamingServer():
+		return "bidi_streaming"
+	case desc.IsStreamingClient():
+		return "client_streaming"
+	case desc.IsStreamingServer():
+		return "server_streaming"
 	}
 	return "unary"
 }
+
+// IsSupported reports whether grpc web supports desc, i.e. whether desc is a
+// unary or server streaming method.
+func IsSupported(desc protoreflect.MethodDescriptor) bool {
+	return !desc.IsStreamingClient()
+}
+
+// SourceLocation returns the location of the declaration at path in file, e.g.
+// "hello.proto:12:3", or just the path of file if it lacks source code info.
+//
+// The locations are searched, since SourceLocations has no ByPath method in
+// the version of protoreflect used, see go.mod. It is only needed for
+// diagnostics.
+func SourceLocation(file protoreflect.FileDescriptor, path protoreflect.SourcePath) string {
+	locs := file.SourceLocations()
+	for i := 0; i < locs.Len(); i++ {
+		loc := locs.Get(i)
+		if fmt.Sprint(loc.Path) == fmt.Sprint(path) {
+			// Lines and columns are zero based.
+			return fmt.Sprintf("%s:%d:%d", file.Path(), loc.StartLine+1, loc.StartColumn+1)
+		}
+	}
+	return file.Path()
+}
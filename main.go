@@ -2,31 +2,419 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
 )
 
+// wellKnownGenerate is the value of the well_known parameter that makes
+// protoc-gen-ts generate the well known types into the output tree instead of
+// importing them from the google-protobuf package.
+const wellKnownGenerate = "generate"
+
+// Values of the import_style parameter.
+const (
+	// importStyleDefault imports npm packages by their default export and
+	// relative modules without file extension, e.g.
+	//
+	// 	import jspb from "google-protobuf";
+	// 	import * as hello_pb from "./hello_pb";
+	//
+	importStyleDefault = "default"
+
+	// importStyleESM uses namespace imports only and adds the ".js"
+	// extension to relative modules, as required by native ES modules and
+	// TypeScripts "nodenext" module resolution, e.g.
+	//
+	// 	import * as jspb from "google-protobuf";
+	// 	import * as hello_pb from "./hello_pb.js";
+	//
+	importStyleESM = "esm"
+
+	// importStyleCommonJS uses CommonJS-style imports, e.g.
+	//
+	// 	import jspb = require("google-protobuf");
+	// 	import hello_pb = require("./hello_pb");
+	//
+	importStyleCommonJS = "commonjs"
+)
+
+// Values of the unsupported_streaming parameter, that determines how client
+// streaming and bidirectional streaming methods are handled, since grpc-web
+// does not support them.
+const (
+	// unsupportedStreamingError fails code generation.
+	unsupportedStreamingError = "error"
+
+	// unsupportedStreamingSkip leaves out the methods, but leaves a comment
+	// in the generated clients.
+	unsupportedStreamingSkip = "skip"
+
+	// unsupportedStreamingStub generates methods that throw a StatusError
+	// with the code UNIMPLEMENTED.
+	unsupportedStreamingStub = "stub"
+)
+
+// streamingTransportWebSocket is the value of the streaming_transport parameter,
+// that makes the generated clients call client streaming and bidirectional
+// streaming methods over WebSockets, see genWebSockets.
+const streamingTransportWebSocket = "websocket"
+
 type parameter struct {
-	WellKnownPath string
+	WellKnownPath     string
+	GenerateWellKnown bool
+	ImportMap         prototype.ImportMap
+	EmbedDescriptors  bool
+	Flatten           bool
+	ImportStyle       string
+	Paths             string
+	Index             string
+	SeparateServices  bool
+	ServicesSuffix    string
+	Target            string
+	PromiseClient     bool
+	AsyncIterable     bool
+	MockClient        bool
+
+	UnsupportedStreaming string
+	StreamingTransport   string
 }
 
 func main() {
-	var params parameter
-	protogen.Options{
-		ParamFunc: func(name, value string) error {
-			if name == "well_known" {
-				params.WellKnownPath = value
-				return nil
-			}
-			return fmt.Errorf("Unrecognized parameter: %s", name)
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
+	}
+}
+
+// run reads the CodeGeneratorRequest from stdin and writes the
+// CodeGeneratorResponse to stdout, like protogen.Options.Run does.
+//
+// The plugin parameters are parsed before the request is handed to protogen,
+// since protogen consumes some of them itself, e.g. M<proto-path>=<module>,
+// whereas they have a different meaning for protoc-gen-ts.
+func run() error {
+	in, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(in, req); err != nil {
+		return err
+	}
+	params, err := parseParameter(req.GetParameter())
+	if err != nil {
+		return err
+	}
+	req.Parameter = nil
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		return err
+	}
+	configure(params)
+	if err := checkStreaming(gen, params); err != nil {
+		gen.Error(err)
+		return writeResponse(gen)
+	}
+	if err := checkPaths(gen, params); err != nil {
+		gen.Error(err)
+		return writeResponse(gen)
+	}
+	if err := checkFlattened(gen, params); err != nil {
+		gen.Error(err)
+		return writeResponse(gen)
+	}
+	runtime := false
+	var indexed []indexedFile
+	for _, f := range gen.Files {
+		if !isGenerated(f, params) {
+			continue
+		}
+		p := generateFile(gen, f, params)
+		runtime = runtime || usesRuntime(f, params)
+		indexed = append(indexed, indexedFile{
+			Path:    prototype.Path(f.Desc),
+			Package: f.Desc.Package(),
+			Exports: p.exports,
+		})
+		if params.SeparateServices && len(f.Services) > 0 {
+			p := generateServicesFile(gen, f, params)
+			indexed = append(indexed, indexedFile{
+				Path:    servicesPath(f, params),
+				Package: f.Desc.Package(),
+				Exports: p.exports,
+			})
+		}
+	}
+	if runtime {
+		genRuntime(gen, params)
+	}
+	if params.Index != "" {
+		genIndexes(gen, indexed, params)
+	}
+	return writeResponse(gen)
+}
+
+// writeResponse writes the CodeGeneratorResponse of gen to stdout.
+func writeResponse(gen *protogen.Plugin) error {
+	out, err := proto.Marshal(gen.Response())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// parseParameter parses the comma separated list of name=value pairs passed
+// to the plugin.
+func parseParameter(s string) (parameter, error) {
+	params := parameter{
+		ImportStyle:    importStyleDefault,
+		Paths:          prototype.PathsSourceRelative,
+		ServicesSuffix: "_grpc_web_pb",
+		Target:         targetTS,
+
+		UnsupportedStreaming: unsupportedStreamingError,
+		ImportMap: prototype.ImportMap{
+			Files:    make(map[string]string),
+			Prefixes: make(map[string]string),
+			Packages: make(map[string]string),
 		},
-	}.Run(func(gen *protogen.Plugin) error {
-		for _, f := range gen.Files {
-			if !f.Generate {
+	}
+	for _, param := range strings.Split(s, ",") {
+		if param == "" {
+			continue
+		}
+		var value string
+		if i := strings.Index(param, "="); i >= 0 {
+			value = param[i+1:]
+			param = param[:i]
+		}
+		switch param {
+		case "well_known":
+			if value == wellKnownGenerate {
+				params.GenerateWellKnown = true
 				continue
 			}
-			generateFile(gen, f, params)
+			params.WellKnownPath = value
+		case "import_prefix":
+			// import_prefix=<proto-path-prefix>=<module-prefix>
+			prefix, mod, err := splitMapping(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.ImportMap.Prefixes[prefix] = mod
+		case "import_package":
+			// import_package=<proto-package>=<module-directory>
+			pkg, mod, err := splitMapping(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.ImportMap.Packages[pkg] = mod
+		case "embed_descriptors":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.EmbedDescriptors = b
+		case "flatten":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.Flatten = b
+		case "import_style":
+			switch value {
+			case importStyleDefault, importStyleESM, importStyleCommonJS:
+				params.ImportStyle = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q, %q or %q, got %q", param, importStyleDefault, importStyleESM, importStyleCommonJS, value)
+			}
+		case "paths":
+			switch value {
+			case prototype.PathsSourceRelative, prototype.PathsImport, prototype.PathsPackage:
+				params.Paths = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q, %q or %q, got %q", param, prototype.PathsSourceRelative, prototype.PathsImport, prototype.PathsPackage, value)
+			}
+		case "index":
+			switch value {
+			case indexDirectory, indexPackage:
+				params.Index = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q or %q, got %q", param, indexDirectory, indexPackage, value)
+			}
+		case "separate_services":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.SeparateServices = b
+		case "services_suffix":
+			params.ServicesSuffix = value
+		case "promise_client":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.PromiseClient = b
+		case "mock_client":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.MockClient = b
+		case "async_iterable":
+			b, err := parseBool(param, value)
+			if err != nil {
+				return params, err
+			}
+			params.AsyncIterable = b
+		case "unsupported_streaming":
+			switch value {
+			case unsupportedStreamingError, unsupportedStreamingSkip, unsupportedStreamingStub:
+				params.UnsupportedStreaming = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q, %q or %q, got %q", param, unsupportedStreamingError, unsupportedStreamingSkip, unsupportedStreamingStub, value)
+			}
+		case "streaming_transport":
+			switch value {
+			case streamingTransportWebSocket:
+				params.StreamingTransport = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q, got %q", param, streamingTransportWebSocket, value)
+			}
+		case "target":
+			switch value {
+			case targetTS, targetJSDTS:
+				params.Target = value
+			default:
+				return params, fmt.Errorf("Invalid value for parameter %s: want %q or %q, got %q", param, targetTS, targetJSDTS, value)
+			}
+		default:
+			// M<proto-path>=<module>
+			if param[0] == 'M' {
+				if len(param) == 1 || value == "" {
+					return params, fmt.Errorf("Invalid parameter %s: want M<proto-path>=<module>", param)
+				}
+				params.ImportMap.Files[param[1:]] = value
+				continue
+			}
+			return params, fmt.Errorf("Unrecognized parameter: %s", param)
+		}
+	}
+	// Import assignments, i.e. import x = require("..."), can not be
+	// compiled to JavaScript without the Typescript compiler.
+	if params.Target == targetJSDTS && params.ImportStyle == importStyleCommonJS {
+		return params, fmt.Errorf("Parameter target=%s does not support import_style=%s", targetJSDTS, importStyleCommonJS)
+	}
+	return params, nil
+}
+
+// checkStreaming returns an error for the first client streaming or
+// bidirectional streaming method of the files to generate, unless these are
+// called over WebSockets or the unsupported_streaming parameter tells how to
+// handle them.
+func checkStreaming(gen *protogen.Plugin, params parameter) error {
+	if params.StreamingTransport != "" || params.UnsupportedStreaming != unsupportedStreamingError {
+		return nil
+	}
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		for _, svc := range f.Services {
+			for _, method := range svc.Methods {
+				if !prototype.IsSupported(method.Desc) {
+					return fmt.Errorf("%s: method %s is client streaming, which grpc-web does not support; set streaming_transport=%s, or unsupported_streaming=%s or unsupported_streaming=%s to generate the other methods", prototype.SourceLocation(f.Desc, method.Location.Path), method.Desc.FullName(), streamingTransportWebSocket, unsupportedStreamingSkip, unsupportedStreamingStub)
+				}
+			}
 		}
+	}
+	return nil
+}
+
+// checkPaths returns an error if two of the generated files are written to
+// the same path, as with paths=package for equally named files of a package
+// in different directories.
+func checkPaths(gen *protogen.Plugin, params parameter) error {
+	seen := make(map[string]*protogen.File)
+	check := func(f *protogen.File, path string) error {
+		if other, ok := seen[path]; ok {
+			return fmt.Errorf("%s and %s are both generated to %s; rename one of them or use another value for paths", other.Desc.Path(), f.Desc.Path(), path)
+		}
+		seen[path] = f
 		return nil
-	})
+	}
+	for _, f := range gen.Files {
+		if !isGenerated(f, params) {
+			continue
+		}
+		if err := check(f, prototype.Path(f.Desc)); err != nil {
+			return err
+		}
+		if params.SeparateServices && len(f.Services) > 0 {
+			if err := check(f, servicesPath(f, params)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFlattened returns an error if the flattened names of two declarations
+// of a generated file clash.
+func checkFlattened(gen *protogen.Plugin, params parameter) error {
+	for _, f := range gen.Files {
+		if !isGenerated(f, params) {
+			continue
+		}
+		if err := prototype.CheckFlattened(f.Desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isGenerated reports whether a Typescript file is generated for f. Well
+// known types are generated along with the files that import them, if
+// requested.
+func isGenerated(f *protogen.File, params parameter) bool {
+	return f.Generate || (params.GenerateWellKnown && prototype.IsWellKnown(f.Desc))
+}
+
+// splitMapping splits the value of a mapping parameter of the form
+// <from>=<to>.
+func splitMapping(param, value string) (string, string, error) {
+	i := strings.Index(value, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("Invalid value for parameter %s: want <from>=<to>, got %q", param, value)
+	}
+	return value[:i], value[i+1:], nil
+}
+
+// parseBool parses the value of a boolean parameter. An empty value, as in
+// "embed_descriptors" without "=true", is true.
+func parseBool(param, value string) (bool, error) {
+	switch value {
+	case "", "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("Invalid value for parameter %s: want \"true\" or \"false\", got %q", param, value)
+	}
+}
+
+// warn reports a diagnostic that does not prevent code generation, like
+// protogen does.
+func warn(format string, a ...interface{}) {
+	log.Printf("WARNING: "+format, a...)
 }
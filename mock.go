@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// genMockClient generates the <Service>MockClient class, that implements the
+// I<Service>Client interface for tests. Its methods are programmed by the
+// runtime.MockMethod and runtime.MockStream of the same name in its mocks
+// property, that also record the requests received.
+func genMockClient(p *Printer, svc *protogen.Service, params parameter) {
+	name := string(svc.Desc.Name())
+	p.P("/**")
+	p.P(" * A mock of I", name, "Client for tests, whose methods are programmed by the")
+	if example := mockExample(svc, params); example != "" {
+		p.P(" * mocks of the same name, e.g.")
+		p.P(" *")
+		p.P(" *     client.mocks.", example, ";")
+	} else {
+		p.P(" * mocks of the same name.")
+	}
+	p.P(" */")
+	p.P(p.Decl("class", name+"MockClient"), p.T(" implements I"+name+"Client"), " {")
+	p.P()
+	p.Indent()
+	p.Types(func() {
+		p.P("readonly mocks: {")
+		p.Indented(func() {
+			for _, method := range mockedMethods(svc, params) {
+				input, output := methodTypes(method, params)
+				p.P("readonly ", strcase.ToLowerCamel(string(method.Desc.Name())), ": ", p.Runtime(mockType(method)), "<", input, ", ", output, ">;")
+			}
+		})
+		p.P("};")
+		p.P()
+	})
+	p.Begin(" {", "constructor()")
+	p.Indented(func() {
+		p.P("this.mocks = {")
+		p.Indented(func() {
+			for _, method := range mockedMethods(svc, params) {
+				p.P(strcase.ToLowerCamel(string(method.Desc.Name())), ": new ", p.Runtime(mockType(method)), "(),")
+			}
+		})
+		p.P("};")
+	})
+	p.End("}") // constructor end
+	p.P()
+
+	for _, method := range svc.Methods {
+		input, output := methodTypes(method, params)
+		name := strcase.ToLowerCamel(string(method.Desc.Name()))
+		mock := "this.mocks." + name
+		switch {
+		case !prototype.IsSupported(method.Desc) && params.StreamingTransport != streamingTransportWebSocket:
+			genUnsupportedMethod(p, method, params)
+			continue
+		case !prototype.IsSupported(method.Desc):
+			p.Begin(" {", name, "()", p.T(": "+p.Runtime("DuplexStream")+"<"+input+", "+output+">"))
+			p.Indented(func() {
+				p.P("return ", mock, ".duplex();")
+			})
+		case method.Desc.IsStreamingServer() && params.AsyncIterable:
+			p.Begin(" {", name, "(request", p.T(": "+input), ")", p.T(": AsyncIterable<"+output+">"))
+			p.Indented(func() {
+				p.P("return ", p.Runtime("iterateStream"), "(", mock, ".stream(request));")
+			})
+		case method.Desc.IsStreamingServer():
+			p.Begin(" {", name, "(request", p.T(": "+input), ")", p.T(": "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"))
+			p.Indented(func() {
+				p.P("return ", mock, ".stream(request)", p.T(" as unknown as "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"), ";")
+			})
+		default:
+			// The callback is the second or third argument, depending on
+			// whether metadata is given.
+			p.Begin(" {", name, "(request", p.T(": "+input), ", ...args", p.T(": unknown[]"), ")", p.T(": "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"))
+			p.Indented(func() {
+				p.P("return ", mock, ".callback(request, args)", p.T(" as unknown as "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"), ";")
+			})
+		}
+		p.End("}") // method end
+		p.P()
+	}
+
+	p.Outdent()
+	p.P("}") // mock client class end
+}
+
+// mockedMethods returns the methods of svc, that the mock client has mocks
+// for.
+func mockedMethods(svc *protogen.Service, params parameter) []*protogen.Method {
+	var methods []*protogen.Method
+	for _, method := range svc.Methods {
+		if prototype.IsSupported(method.Desc) || params.StreamingTransport == streamingTransportWebSocket {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// mockType returns the name of the runtime class that mocks method.
+func mockType(method *protogen.Method) string {
+	if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+		return "MockStream"
+	}
+	return "MockMethod"
+}
+
+// mockExample returns the example in the documentation of the mock client,
+// that programs the mock of the first mocked method of svc, if any.
+func mockExample(svc *protogen.Service, params parameter) string {
+	methods := mockedMethods(svc, params)
+	if len(methods) == 0 {
+		return ""
+	}
+	name := strcase.ToLowerCamel(string(methods[0].Desc.Name()))
+	if mockType(methods[0]) == "MockStream" {
+		return name + ".script([response])"
+	}
+	return name + ".respond(response)"
+}
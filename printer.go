@@ -4,32 +4,286 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
+// Modes of a Printer.
+const (
+	// modeTS prints Typescript.
+	modeTS = iota
+
+	// modeJS prints JavaScript, i.e. Typescript with all type information
+	// removed.
+	modeJS
+
+	// modeDTS prints Typescript declarations, i.e. Typescript without
+	// implementations.
+	modeDTS
+)
+
+// Values of the target parameter.
+const (
+	// targetTS generates Typescript files.
+	targetTS = "ts"
+
+	// targetJSDTS generates JavaScript files along with Typescript
+	// declaration files.
+	targetJSDTS = "js+dts"
+)
+
+// Printer prints Typescript code to G.
+//
+// The same code can be printed as Typescript, as JavaScript or as Typescript
+// declarations, depending on the mode of the Printer. For that, the parts of
+// the code that are specific to any of the modes must be marked using T,
+// Types, Impl, Signatures, Begin and End, Decl and BeginNamespace and
+// EndNamespace.
+//
+// Identifiers exported by other modules, i.e. by the files generated for other
+// proto files, by the npm packages and by the runtime support file, are
+// qualified by QualifiedIdent, that records the modules to import. The Printer
+// records which of the qualified identifiers are printed, and whether at type
+// level only, to tell which imports are used, see Uses. Since the imports
+// precede the code that uses them, they are printed by Insert at a position
+// that was marked with Mark before.
 type Printer struct {
 	G      *protogen.GeneratedFile
 	indent int
+	mode   int
+
+	// path is the path of the generated file.
+	path string
+
+	// ctx is the proto file that the printed code is generated for, if any.
+	ctx protoreflect.FileDescriptor
+
+	// modules are the modules of the identifiers qualified by
+	// QualifiedIdent, in the order of their first use.
+	modules []*prototype.Import
+
+	// moduleOf maps proto paths to their modules.
+	moduleOf map[string]*prototype.Import
+
+	// skip is greater than zero while the printed code is not part of the
+	// output for the mode of the printer.
+	skip int
+
+	// types is greater than zero while the printed code only exists at type
+	// level, see Types.
+	types int
+
+	// uses maps the import aliases used by the printed code to whether they
+	// are used at type level only.
+	uses map[string]bool
+
+	// marked holds the lines printed since Mark, until they are written
+	// to G by Insert. It is nil, if no position is marked.
+	marked []string
+
+	// exports are the top level declarations that are exported from G.
+	exports []export
+
+	// namespaces is the stack of namespaces the printer is in.
+	namespaces []*namespace
 }
 
-func newPrinter(g *protogen.GeneratedFile) *Printer {
+// export is a top level declaration that is exported from a generated file.
+type export struct {
+	Name string
+	// TypeOnly is set for declarations that only exist at type level, e.g.
+	// type aliases and interfaces.
+	TypeOnly bool
+}
+
+// namespace is a Typescript namespace. For JavaScript, namespaces are emulated
+// the way the Typescript compiler does it.
+type namespace struct {
+	Name string
+	// Members are the exported declarations of the namespace that exist at
+	// runtime.
+	Members []string
+}
+
+func newPrinter(g *protogen.GeneratedFile, path string, ctx protoreflect.FileDescriptor) *Printer {
 	return &Printer{
-		G:      g,
-		indent: 0,
+		G:        g,
+		indent:   0,
+		path:     path,
+		ctx:      ctx,
+		moduleOf: make(map[string]*prototype.Import),
+		uses:     make(map[string]bool),
+	}
+}
+
+// newPrinters returns the printers for the Typescript file at path, that is
+// generated for ctx, i.e. a single Typescript printer or, for the target
+// "js+dts", a JavaScript printer for the ".js" file and a declaration printer
+// for the ".d.ts" file.
+//
+// ctx is nil for files that are not generated for a proto file, e.g. the
+// runtime support file.
+func newPrinters(gen *protogen.Plugin, path string, ctx protoreflect.FileDescriptor, params parameter) []*Printer {
+	if params.Target != targetJSDTS {
+		return []*Printer{newPrinter(gen.NewGeneratedFile(path, ""), path, ctx)}
 	}
+	base := strings.TrimSuffix(path, ".ts")
+	js := newPrinter(gen.NewGeneratedFile(base+".js", ""), path, ctx)
+	js.mode = modeJS
+	dts := newPrinter(gen.NewGeneratedFile(base+".d.ts", ""), path, ctx)
+	dts.mode = modeDTS
+	return []*Printer{js, dts}
+}
+
+// reservedAliases are the aliases of the imports that are not proto files.
+var reservedAliases = map[string]bool{
+	string(prototype.ModuleJSPB):    true,
+	string(prototype.ModuleGRPCWeb): true,
+	string(prototype.ModuleRuntime): true,
+}
+
+// QualifiedIdent returns the name of ident qualified by the alias that the
+// module exporting ident is imported as, and records the module to be
+// imported, like protogen.GeneratedFile.QualifiedGoIdent.
+//
+// Modules are aliased by prototype.ImportAlias. If the alias is taken by
+// another module, e.g. for "a/v1/common.proto" and "b/v1/common.proto" of the
+// same package "x.v1", prototype.PathAlias is used instead. Identifiers of
+// files that are reached through public imports are imported from the file
+// that re-exports them, see prototype.Exporter. The modules that are not
+// generated for proto files are imported as their name, e.g. "jspb".
+func (p *Printer) QualifiedIdent(ident prototype.Ident) string {
+	if ident.File == nil {
+		return qualified(string(ident.Module), ident.Name)
+	}
+	file := ident.File
+	if p.ctx != nil {
+		file = prototype.Exporter(p.ctx, file)
+	}
+	mod, ok := p.moduleOf[file.Path()]
+	if !ok {
+		mod = &prototype.Import{
+			Path:  prototype.ImportPath(p.path, p.ctx, file),
+			Alias: p.uniqueAlias(file),
+		}
+		p.moduleOf[file.Path()] = mod
+		p.modules = append(p.modules, mod)
+	}
+	return qualified(mod.Alias, ident.Name)
+}
+
+// JSPB returns name qualified as exported by google-protobuf, e.g.
+// "jspb.Message".
+func (p *Printer) JSPB(name string) string {
+	return p.QualifiedIdent(prototype.Ident{Module: prototype.ModuleJSPB, Name: name})
+}
+
+// GRPCWeb returns name qualified as exported by grpc-web, e.g.
+// "grpcweb.Metadata".
+func (p *Printer) GRPCWeb(name string) string {
+	return p.QualifiedIdent(prototype.Ident{Module: prototype.ModuleGRPCWeb, Name: name})
+}
+
+// Runtime returns name qualified as exported by the runtime support file, e.g.
+// "runtime.CallOptions".
+func (p *Printer) Runtime(name string) string {
+	return p.QualifiedIdent(prototype.Ident{Module: prototype.ModuleRuntime, Name: name})
+}
+
+// qualifiedMark encloses the import alias of the identifiers returned by
+// QualifiedIdent, so that P records the use of the import. It is removed from
+// the printed code.
+const qualifiedMark = "\x00"
+
+// qualified returns name qualified by alias.
+func qualified(alias, name string) string {
+	return qualifiedMark + alias + qualifiedMark + "." + name
+}
+
+// uniqueAlias returns an alias for file, that is not taken by any other
+// module.
+func (p *Printer) uniqueAlias(file protoreflect.FileDescriptor) string {
+	taken := func(alias string) bool {
+		if reservedAliases[alias] {
+			return true
+		}
+		for _, mod := range p.modules {
+			if mod.Alias == alias {
+				return true
+			}
+		}
+		return false
+	}
+	alias := prototype.ImportAlias(file)
+	if taken(alias) {
+		alias = prototype.PathAlias(file)
+	}
+	for i, base := 2, alias; taken(alias); i++ {
+		alias = fmt.Sprintf("%s%d", base, i)
+	}
+	return alias
 }
 
 func (p *Printer) P(v ...interface{}) {
+	if p.skip > 0 {
+		return
+	}
+	var line strings.Builder
 	// Do not indent on empty lines, i.e. if v is nil.
 	if v != nil {
-		ind := []interface{}{strings.Repeat(" ", p.indent)}
-		v = append(ind, v...)
+		line.WriteString(strings.Repeat(" ", p.indent))
+	}
+	for _, x := range v {
+		s := fmt.Sprint(x)
+		_, typeOnly := x.(typeInfo)
+		p.use(s, typeOnly || p.types > 0)
+		line.WriteString(strings.Replace(s, qualifiedMark, "", -1))
+	}
+	if p.marked != nil {
+		p.marked = append(p.marked, line.String())
+		return
 	}
-	p.G.P(v...)
+	p.G.P(line.String())
 }
 
 func (p *Printer) F(format string, a ...interface{}) {
-	p.G.P(fmt.Sprintf(strings.Repeat(" ", p.indent)+format, a...))
+	p.P(fmt.Sprintf(format, a...))
+}
+
+// use records the import aliases of the identifiers qualified by
+// QualifiedIdent in code s.
+func (p *Printer) use(s string, typeOnly bool) {
+	parts := strings.Split(s, qualifiedMark)
+	for i := 1; i < len(parts); i += 2 {
+		if only, ok := p.uses[parts[i]]; ok && !only {
+			continue
+		}
+		p.uses[parts[i]] = typeOnly
+	}
+}
+
+// Uses reports whether the code printed so far uses the import alias, and if
+// so, whether it is used at type level only.
+func (p *Printer) Uses(alias string) (used bool, typeOnly bool) {
+	typeOnly, used = p.uses[alias]
+	return used, typeOnly
+}
+
+// Mark marks the current position, so that code can be inserted there by
+// Insert once the code that follows is printed.
+func (p *Printer) Mark() {
+	p.marked = []string{}
+}
+
+// Insert prints the code printed by f at the position marked by Mark.
+func (p *Printer) Insert(f func()) {
+	lines := p.marked
+	p.marked = nil
+	f()
+	for _, line := range lines {
+		p.G.P(line)
+	}
 }
 
 func (p *Printer) C(comm protogen.Comments) {
@@ -58,3 +312,137 @@ func (p *Printer) Indented(f func()) {
 	f()
 	p.Outdent()
 }
+
+// typeInfo is code that only exists at type level.
+type typeInfo string
+
+// T returns the type information s, e.g. a type annotation like ": number",
+// unless p prints JavaScript.
+func (p *Printer) T(s string) typeInfo {
+	if p.mode == modeJS {
+		return ""
+	}
+	return typeInfo(s)
+}
+
+// Types prints the code printed by f, unless p prints JavaScript. It is used
+// for code that only exists at type level, e.g. type aliases.
+func (p *Printer) Types(f func()) {
+	if p.mode == modeJS {
+		p.skip++
+		defer func() { p.skip-- }()
+	}
+	p.types++
+	defer func() { p.types-- }()
+	f()
+}
+
+// Impl prints the code printed by f, unless p prints declarations. It is used
+// for code that does not declare anything, e.g. statements and module private
+// constants.
+func (p *Printer) Impl(f func()) {
+	if p.mode == modeDTS {
+		p.skip++
+		defer func() { p.skip-- }()
+	}
+	f()
+}
+
+// Signatures prints the code printed by f as declarations, e.g. the methods of
+// a class as the methods of an interface.
+func (p *Printer) Signatures(f func()) {
+	mode := p.mode
+	p.mode = modeDTS
+	defer func() { p.mode = mode }()
+	f()
+}
+
+// Begin prints head followed by open, e.g. a method signature followed by " {".
+// The code printed until the matching End is the implementation that belongs
+// to head, e.g. the method body or the initializer of a property.
+//
+// When printing declarations, head is terminated by ";" instead and the
+// implementation is omitted.
+func (p *Printer) Begin(open string, head ...interface{}) {
+	if p.mode == modeDTS {
+		p.P(append(head, ";")...)
+		p.skip++
+		return
+	}
+	p.P(append(head, open)...)
+}
+
+// End prints close, e.g. "}", to end the implementation begun with Begin.
+func (p *Printer) End(close string) {
+	if p.mode == modeDTS {
+		p.skip--
+		return
+	}
+	p.P(close)
+}
+
+// Decl returns the beginning of the exported declaration of name of the given
+// kind, e.g. "export class Foo", and records name as exported.
+//
+// The keyword kind is one of "class", "enum", "var", "const", "function",
+// "type" or "interface". The latter two declare types only.
+func (p *Printer) Decl(kind, name string) string {
+	typeOnly := kind == "type" || kind == "interface"
+	if len(p.namespaces) > 0 {
+		ns := p.namespaces[len(p.namespaces)-1]
+		if p.mode == modeJS {
+			// Namespaces are emulated by functions, so their members
+			// are not exported but assigned to the namespace object.
+			if !typeOnly {
+				ns.Members = append(ns.Members, name)
+			}
+			return kind + " " + name
+		}
+		return "export " + kind + " " + name
+	}
+	p.exports = append(p.exports, export{Name: name, TypeOnly: typeOnly})
+	if p.mode == modeDTS && !typeOnly {
+		return "export declare " + kind + " " + name
+	}
+	return "export " + kind + " " + name
+}
+
+// BeginNamespace begins the namespace name that merges with the declaration of
+// name that precedes it, e.g. a class.
+//
+// For JavaScript, the namespace is emulated like the Typescript compiler does
+// it, i.e. by a function that assigns the members of the namespace to the
+// namespace object.
+func (p *Printer) BeginNamespace(name string) {
+	switch p.mode {
+	case modeJS:
+		p.P("(function (", name, ") {")
+	case modeDTS:
+		if len(p.namespaces) > 0 {
+			p.P("export namespace ", name, " {")
+		} else {
+			p.P("export declare namespace ", name, " {")
+		}
+	default:
+		p.P("export namespace ", name, " {")
+	}
+	p.namespaces = append(p.namespaces, &namespace{Name: name})
+	p.Indent()
+}
+
+// EndNamespace ends the namespace begun with BeginNamespace.
+func (p *Printer) EndNamespace() {
+	ns := p.namespaces[len(p.namespaces)-1]
+	p.namespaces = p.namespaces[:len(p.namespaces)-1]
+	if p.mode == modeJS {
+		for _, member := range ns.Members {
+			p.P(ns.Name, ".", member, " = ", member, ";")
+		}
+	}
+	p.Outdent()
+	if p.mode == modeJS {
+		p.P("})(", ns.Name, " || (", ns.Name, " = {}));")
+		return
+	}
+	p.P("}")
+}
@@ -0,0 +1,1230 @@
+package main
+
+import (
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// genRuntime generates the runtime support file at prototype.RuntimePath.
+//
+// The runtime support file contains the code that is shared by all generated
+// files, e.g. the registry that generated messages register themselves in.
+// Its content does not depend on the proto files, so that the runtime support
+// files of different protoc invocations into the same output tree are equal,
+// as long as these use the same parameters. Optional parts, e.g. the WebSocket
+// transport or the mocks of the mock clients, are only generated if the
+// parameters enable them.
+func genRuntime(gen *protogen.Plugin, params parameter) {
+	for _, p := range newPrinters(gen, prototype.RuntimePath, nil, params) {
+		genRuntimeFile(p, params)
+	}
+}
+
+func genRuntimeFile(p *Printer, params parameter) {
+	p.P("// Code generated by protoc-gen-ts. DO NOT EDIT.")
+	p.P("// versions:")
+	p.P("// 	protoc-gen-go ", "v0.0.1-devel")
+	p.P()
+	p.Mark()
+	defer p.Insert(func() {
+		genPackageImport(p, "jspb", "google-protobuf", params)
+		p.P()
+	})
+
+	genRegistry(p)
+	p.P()
+
+	genFieldInfo(p)
+	p.P()
+
+	genServiceInfo(p)
+	p.P()
+
+	genCalls(p)
+	p.P()
+
+	genStatus(p)
+	p.P()
+
+	genStreams(p)
+
+	if params.StreamingTransport == streamingTransportWebSocket {
+		p.P()
+		genWebSockets(p)
+	}
+
+	if params.MockClient {
+		p.P()
+		genMocks(p)
+	}
+}
+
+// genRegistry generates the registry of files and messages.
+//
+// Generated files register their serialized FileDescriptorProto and their
+// messages when the embed_descriptors parameter is set.
+func genRegistry(p *Printer) {
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The constructor of a generated message class.")
+		p.P(" */")
+		p.P(p.Decl("type", "MessageConstructor"), "<T extends ", p.JSPB("Message"), " = ", p.JSPB("Message"), "> = new (data?: ", p.JSPB("Message"), ".MessageArray) => T;")
+		p.P()
+		p.P("/**")
+		p.P(" * A generated message class.")
+		p.P(" */")
+		p.P(p.Decl("interface", "MessageType"), "<T extends ", p.JSPB("Message"), " = ", p.JSPB("Message"), "> extends MessageConstructor<T> {")
+		p.Indented(func() {
+			p.P("readonly typeName: string;")
+			p.P("deserializeBinary(bytes: Uint8Array): T;")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.Impl(func() {
+		p.P("const files = new Map", p.T("<string, Uint8Array>"), "();")
+		p.P()
+		p.P("const messages = new Map", p.T("<string, MessageType>"), "();")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * Registers the base64 encoded FileDescriptorProto of the proto file name.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "registerFile"), "(name", p.T(": string"), ", descriptor", p.T(": string"), ")", p.T(": void"))
+	p.Indented(func() {
+		p.P("files.set(name, ", p.JSPB("Message"), ".bytesAsU8(descriptor));")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * Returns the serialized FileDescriptorProto of the proto file name.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "lookupFile"), "(name", p.T(": string"), ")", p.T(": Uint8Array | undefined"))
+	p.Indented(func() {
+		p.P("return files.get(name);")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * Registers the message class type under its full name.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "registerMessage"), "(type", p.T(": MessageType"), ")", p.T(": void"))
+	p.Indented(func() {
+		p.P("messages.set(type.typeName, type);")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * Returns the message class registered for the full name typeName.")
+	p.P(" *")
+	p.P(" * typeName might also be a type URL as used by google.protobuf.Any,")
+	p.P(" * e.g. \"type.googleapis.com/google.protobuf.Duration\".")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "lookupMessage"), "(typeName", p.T(": string"), ")", p.T(": MessageType | undefined"))
+	p.Indented(func() {
+		p.P("return messages.get(typeName.substring(typeName.lastIndexOf(\"/\") + 1));")
+	})
+	p.End("}")
+}
+
+// genFieldInfo generates the types of the runtime field metadata, that
+// generated messages expose in their static fields property.
+func genFieldInfo(p *Printer) {
+	p.Types(func() {
+		genFieldInfoTypes(p)
+	})
+}
+
+func genFieldInfoTypes(p *Printer) {
+	p.P("/**")
+	p.P(" * The proto kind of a field.")
+	p.P(" */")
+	p.P(p.Decl("type", "FieldKind"), " =")
+	p.Indented(func() {
+		kinds := []string{"double", "float", "int64", "uint64", "int32", "fixed64", "fixed32", "bool", "string", "group", "message", "bytes", "uint32", "enum", "sfixed32", "sfixed64", "sint32", "sint64"}
+		for i, kind := range kinds {
+			suffix := ""
+			if i == len(kinds)-1 {
+				suffix = ";"
+			}
+			p.P("| \"", kind, "\"", suffix)
+		}
+	})
+	p.P()
+	p.P("/**")
+	p.P(" * A generated enum.")
+	p.P(" */")
+	p.P(p.Decl("type", "EnumObject"), " = { readonly [key: string]: string | number };")
+	p.P()
+	p.P("/**")
+	p.P(" * Runtime metadata of a field of a generated message.")
+	p.P(" */")
+	p.P(p.Decl("interface", "FieldInfo"), " {")
+	p.Indented(func() {
+		p.P("/** The field number. */")
+		p.P("readonly no: number;")
+		p.P("/** The field name as declared in the proto file. */")
+		p.P("readonly name: string;")
+		p.P("/** The JSON name of the field. */")
+		p.P("readonly jsonName: string;")
+		p.P("/** The kind of the field. For map fields, the kind of the map values. */")
+		p.P("readonly kind: FieldKind;")
+		p.P("/** The label of the field. Map fields are repeated. */")
+		p.P("readonly label: \"optional\" | \"required\" | \"repeated\";")
+		p.P("/** The kind of the map keys, if the field is a map field. */")
+		p.P("readonly mapKey?: FieldKind;")
+		p.P("/** The name of the oneof the field is part of, if any. */")
+		p.P("readonly oneof?: string;")
+		p.P("/**")
+		p.P(" * Returns the message class respec. enum of message and enum fields.")
+		p.P(" * Evaluated lazily, since messages might refer to themselves or to")
+		p.P(" * messages that are declared further down.")
+		p.P(" */")
+		p.P("readonly T?: () => MessageConstructor | EnumObject;")
+	})
+	p.P("}")
+}
+
+// genServiceInfo generates the types of the service descriptors, that the
+// generated files export for their services.
+func genServiceInfo(p *Printer) {
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The streaming kind of a method.")
+		p.P(" */")
+		p.P(p.Decl("type", "MethodKind"), " = \"unary\" | \"server_streaming\" | \"client_streaming\" | \"bidi_streaming\";")
+		p.P()
+		p.P("/**")
+		p.P(" * The descriptor of a method of a service.")
+		p.P(" */")
+		p.P(p.Decl("interface", "ServiceMethodInfo"), "<Req extends ", p.JSPB("Message"), " = ", p.JSPB("Message"), ", Res extends ", p.JSPB("Message"), " = ", p.JSPB("Message"), "> {")
+		p.Indented(func() {
+			p.P("/** The method name as declared in the proto file. */")
+			p.P("readonly name: string;")
+			p.P("/** The path the method is called at, e.g. \"/hello.Greeter/Greet\". */")
+			p.P("readonly path: string;")
+			p.P("readonly kind: MethodKind;")
+			p.P("readonly requestType: MessageConstructor<Req>;")
+			p.P("readonly responseType: MessageConstructor<Res>;")
+			p.P("readonly options: {")
+			p.Indented(func() {
+				p.P("readonly deprecated: boolean;")
+				p.P("readonly idempotencyLevel: \"IDEMPOTENCY_UNKNOWN\" | \"NO_SIDE_EFFECTS\" | \"IDEMPOTENT\";")
+			})
+			p.P("};")
+		})
+		p.P("}")
+		p.P()
+		p.P("/**")
+		p.P(" * The descriptor of a service.")
+		p.P(" */")
+		p.P(p.Decl("interface", "ServiceInfo"), "<Methods extends { readonly [method: string]: ServiceMethodInfo } = { readonly [method: string]: ServiceMethodInfo }> {")
+		p.Indented(func() {
+			p.P("/** The full name of the service, e.g. \"hello.Greeter\". */")
+			p.P("readonly typeName: string;")
+			p.P("/** The methods of the service by their lower camel case names. */")
+			p.P("readonly methods: Methods;")
+		})
+		p.P("}")
+	})
+}
+
+// genStreams generates the adapter of server streams to AsyncIterables, that
+// the server streaming methods of generated clients return when the
+// async_iterable parameter is set, and the type of the calls of client
+// streaming and bidirectional streaming methods.
+func genStreams(p *Printer) {
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The stream of a server streaming call, e.g. a grpcweb.ClientReadableStream.")
+		p.P(" */")
+		p.P(p.Decl("interface", "ServerStream"), "<T> {")
+		p.Indented(func() {
+			p.P("on(eventType: \"data\", callback: (response: T) => void): unknown;")
+			p.P("on(eventType: \"error\", callback: (err: CallError) => void): unknown;")
+			p.P("on(eventType: \"end\", callback: () => void): unknown;")
+			p.P("cancel(): void;")
+		})
+		p.P("}")
+		p.P()
+		p.P("/**")
+		p.P(" * A call of a client streaming or bidirectional streaming method.")
+		p.P(" *")
+		p.P(" * The responses are iterated asynchronously. The iteration throws a")
+		p.P(" * StatusError if the call fails.")
+		p.P(" */")
+		p.P(p.Decl("interface", "DuplexStream"), "<Req, Res> extends AsyncIterable<Res> {")
+		p.Indented(func() {
+			p.P("/** Sends request to the server. */")
+			p.P("send(request: Req): void;")
+			p.P("/** Ends the requests, i.e. tells the server that no more requests are sent. */")
+			p.P("end(): void;")
+			p.P("/** Cancels the call. */")
+			p.P("cancel(): void;")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * Adapts stream to an AsyncIterable of its responses.")
+	p.P(" *")
+	p.P(" * Since a stream can not be paused, responses that are received before they")
+	p.P(" * are consumed are buffered, so that none of them is lost. The iteration")
+	p.P(" * throws the error of the stream with its status, see withStatus, once the")
+	p.P(" * responses received before it are consumed. Aborting signal, as well as")
+	p.P(" * leaving the iteration early, cancels the stream.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "iterateStream"), p.T("<T>"), "(stream", p.T(": ServerStream<T>"), ", signal", p.T("?: AbortSignal"), ")", p.T(": AsyncIterable<T>"))
+	p.Indented(func() {
+		// The listeners are added right away rather than once the
+		// iteration starts, so that no response is missed.
+		p.P("const buffer", p.T(": T[]"), " = [];")
+		p.P("let done = false;")
+		p.P("let error", p.T(": unknown"), " = undefined;")
+		p.P("let wake", p.T(": (() => void) | undefined"), ";")
+		p.P("const notify = () => {")
+		p.Indented(func() {
+			p.P("wake?.();")
+			p.P("wake = undefined;")
+		})
+		p.P("};")
+		p.P("stream.on(\"data\", (response", p.T(": T"), ") => {")
+		p.Indented(func() {
+			p.P("buffer.push(response);")
+			p.P("notify();")
+		})
+		p.P("});")
+		p.P("stream.on(\"error\", (err", p.T(": CallError"), ") => {")
+		p.Indented(func() {
+			p.P("error = withStatus(err);")
+			p.P("done = true;")
+			p.P("notify();")
+		})
+		p.P("});")
+		p.P("stream.on(\"end\", () => {")
+		p.Indented(func() {
+			p.P("done = true;")
+			p.P("notify();")
+		})
+		p.P("});")
+		p.P("const abort = () => {")
+		p.Indented(func() {
+			p.P("stream.cancel();")
+			p.P("buffer.length = 0;")
+			p.P("error = new DOMException(\"The operation was aborted.\", \"AbortError\");")
+			p.P("done = true;")
+			p.P("notify();")
+		})
+		p.P("};")
+		p.P("if (signal?.aborted) {")
+		p.Indented(func() {
+			p.P("abort();")
+		})
+		p.P("} else {")
+		p.Indented(func() {
+			p.P("signal?.addEventListener(\"abort\", abort, { once: true });")
+		})
+		p.P("}")
+		p.P("return (async function* () {")
+		p.Indented(func() {
+			p.P("try {")
+			p.Indented(func() {
+				p.P("while (true) {")
+				p.Indented(func() {
+					p.P("if (buffer.length > 0) {")
+					p.Indented(func() {
+						p.P("yield buffer.shift()", p.T("!"), ";")
+					})
+					p.P("} else if (error !== undefined) {")
+					p.Indented(func() {
+						p.P("throw error;")
+					})
+					p.P("} else if (done) {")
+					p.Indented(func() {
+						p.P("return;")
+					})
+					p.P("} else {")
+					p.Indented(func() {
+						p.P("await new Promise", p.T("<void>"), "((resolve) => (wake = resolve));")
+					})
+					p.P("}")
+				})
+				p.P("}")
+			})
+			p.P("} finally {")
+			p.Indented(func() {
+				p.P("signal?.removeEventListener(\"abort\", abort);")
+				p.P("if (!done) {")
+				p.Indented(func() {
+					p.P("stream.cancel();")
+				})
+				p.P("}")
+			})
+			p.P("}")
+		})
+		p.P("})();")
+	})
+	p.End("}")
+}
+
+// genCalls generates the options of the calls of generated client methods,
+// and the helpers applying them.
+func genCalls(p *Printer) {
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * Options of a call of a generated client method.")
+		p.P(" */")
+		p.P(p.Decl("interface", "CallOptions"), " {")
+		p.Indented(func() {
+			p.P("/** The metadata that is sent along with the request, e.g. extra headers. */")
+			p.P("readonly metadata?: { [key: string]: string };")
+			p.P("/** The deadline of the call, as Date or in milliseconds since the epoch. */")
+			p.P("readonly deadline?: Date | number;")
+			p.P("/** The timeout of the call in milliseconds, if no deadline is given. */")
+			p.P("readonly timeout?: number;")
+			p.P("/** Cancels the call when aborted. */")
+			p.P("readonly signal?: AbortSignal;")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * Returns the metadata of a call, i.e. metadata merged with the metadata of")
+	p.P(" * options, and the deadline of options, that grpc-web sends as grpc-timeout.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "callMetadata"), "(metadata", p.T("?: { [key: string]: string }"), ", options", p.T("?: CallOptions"), ")", p.T(": { [key: string]: string }"))
+	p.Indented(func() {
+		p.P("const result", p.T(": { [key: string]: string }"), " = { ...metadata, ...options?.metadata };")
+		p.P("let deadline = options?.deadline;")
+		p.P("if (deadline === undefined && options?.timeout !== undefined) {")
+		p.Indented(func() {
+			p.P("deadline = Date.now() + options.timeout;")
+		})
+		p.P("}")
+		p.P("if (deadline !== undefined) {")
+		p.Indented(func() {
+			p.P("result[\"deadline\"] = String(deadline instanceof Date ? deadline.getTime() : deadline);")
+		})
+		p.P("}")
+		p.P("return result;")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * Cancels stream when signal is aborted, and returns stream.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "bindSignal"), p.T("<S extends { cancel(): void }>"), "(stream", p.T(": S"), ", signal", p.T("?: AbortSignal"), ")", p.T(": S"))
+	p.Indented(func() {
+		p.P("if (signal?.aborted) {")
+		p.Indented(func() {
+			p.P("stream.cancel();")
+		})
+		p.P("} else {")
+		p.Indented(func() {
+			p.P("signal?.addEventListener(\"abort\", () => stream.cancel(), { once: true });")
+		})
+		p.P("}")
+		p.P("return stream;")
+	})
+	p.End("}")
+}
+
+// statusCodes are the canonical gRPC status codes.
+var statusCodes = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// genStatus generates the status codes, withStatus, that decodes the status of
+// the grpcweb.RpcError that calls made by grpc-web fail with, and the
+// StatusError, that other calls fail with, e.g. calls over WebSockets.
+//
+// The status is decoded from the google.rpc.Status sent in the
+// "grpc-status-details-bin" trailer. The detail messages are looked up in
+// the registry, thus they are unpacked into the generated classes only if
+// these are generated with the embed_descriptors parameter.
+func genStatus(p *Printer) {
+	p.P("/**")
+	p.P(" * The status code of a call.")
+	p.P(" */")
+	var values []enumValue
+	for i, code := range statusCodes {
+		values = append(values, enumValue{Name: code, Number: int32(i)})
+	}
+	genEnumDecl(p, "StatusCode", values)
+	p.P()
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The error a call fails with, e.g. a grpcweb.RpcError.")
+		p.P(" */")
+		p.P(p.Decl("interface", "CallError"), " {")
+		p.Indented(func() {
+			p.P("readonly code: number;")
+			p.P("readonly message: string;")
+			p.P("readonly metadata?: { [key: string]: string };")
+		})
+		p.P("}")
+		p.P()
+		p.P("/**")
+		p.P(" * A detail of a Status, whose message type is not registered.")
+		p.P(" */")
+		p.P(p.Decl("interface", "UnknownDetail"), " {")
+		p.Indented(func() {
+			p.P("/** The type URL of the google.protobuf.Any the detail is packed in. */")
+			p.P("readonly typeUrl: string;")
+			p.P("/** The serialized detail message. */")
+			p.P("readonly value: Uint8Array;")
+		})
+		p.P("}")
+		p.P()
+		p.P("/**")
+		p.P(" * A google.rpc.Status, whose details are unpacked.")
+		p.P(" */")
+		p.P(p.Decl("interface", "Status"), " {")
+		p.Indented(func() {
+			p.P("readonly code: StatusCode;")
+			p.P("readonly message: string;")
+			p.P("readonly details: (", p.JSPB("Message"), " | UnknownDetail)[];")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * Decodes the serialized google.rpc.Status bytes. Its details are unpacked")
+	p.P(" * into the message classes registered for their type URLs.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "decodeStatus"), "(bytes", p.T(": Uint8Array"), ")", p.T(": Status"))
+	p.Indented(func() {
+		p.P("const reader = new ", p.JSPB("BinaryReader"), "(bytes);")
+		p.P("let code = StatusCode.OK;")
+		p.P("let message = \"\";")
+		p.P("const details", p.T(": ("+p.JSPB("Message")+" | UnknownDetail)[]"), " = [];")
+		p.P("while (reader.nextField()) {")
+		p.Indented(func() {
+			p.P("if (reader.isEndGroup()) {")
+			p.Indented(func() {
+				p.P("break;")
+			})
+			p.P("}")
+			p.P("switch (reader.getFieldNumber()) {")
+			p.Indented(func() {
+				p.P("case 1:")
+				p.Indented(func() {
+					p.P("code = reader.readInt32();")
+					p.P("break;")
+				})
+				p.P("case 2:")
+				p.Indented(func() {
+					p.P("message = reader.readString();")
+					p.P("break;")
+				})
+				p.P("case 3:")
+				p.Indented(func() {
+					p.P("details.push(unpackDetail(reader.readBytes()));")
+					p.P("break;")
+				})
+				p.P("default:")
+				p.Indented(func() {
+					p.P("reader.skipField();")
+				})
+			})
+			p.P("}")
+		})
+		p.P("}")
+		p.P("return { code, message, details };")
+	})
+	p.End("}")
+	p.P()
+	p.Impl(func() {
+		p.P("function unpackDetail(bytes", p.T(": Uint8Array"), ")", p.T(": "+p.JSPB("Message")+" | UnknownDetail"), " {")
+		p.Indented(func() {
+			p.P("const reader = new ", p.JSPB("BinaryReader"), "(bytes);")
+			p.P("let typeUrl = \"\";")
+			p.P("let value = new Uint8Array(0);")
+			p.P("while (reader.nextField()) {")
+			p.Indented(func() {
+				p.P("if (reader.isEndGroup()) {")
+				p.Indented(func() {
+					p.P("break;")
+				})
+				p.P("}")
+				p.P("switch (reader.getFieldNumber()) {")
+				p.Indented(func() {
+					p.P("case 1:")
+					p.Indented(func() {
+						p.P("typeUrl = reader.readString();")
+						p.P("break;")
+					})
+					p.P("case 2:")
+					p.Indented(func() {
+						p.P("value = reader.readBytes();")
+						p.P("break;")
+					})
+					p.P("default:")
+					p.Indented(func() {
+						p.P("reader.skipField();")
+					})
+				})
+				p.P("}")
+			})
+			p.P("}")
+			p.P("const type = lookupMessage(typeUrl);")
+			p.P("return type ? type.deserializeBinary(value) : { typeUrl, value };")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The status of a failed call, decoded from the \"grpc-status-details-bin\"")
+		p.P(" * trailer, if the server sent one, e.g. to report the violations of a")
+		p.P(" * google.rpc.BadRequest.")
+		p.P(" */")
+		p.P(p.Decl("interface", "StatusDetails"), " {")
+		p.Indented(func() {
+			p.P("/** The status sent in the trailers, if any. */")
+			p.P("readonly status?: Status;")
+			p.P("/** The details of the status, if any. */")
+			p.P("readonly details: (", p.JSPB("Message"), " | UnknownDetail)[];")
+		})
+		p.P("}")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * Adds the status decoded from the trailers of err, e.g. a grpcweb.RpcError,")
+	p.P(" * to err and returns err.")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "withStatus"), p.T("<E extends CallError>"), "(err", p.T(": E"), ")", p.T(": E & StatusDetails"))
+	p.Indented(func() {
+		p.P("if (err instanceof StatusError) {")
+		p.Indented(func() {
+			p.P("return err;")
+		})
+		p.P("}")
+		p.P("const bytes = err.metadata?.[\"grpc-status-details-bin\"];")
+		p.P("const status = bytes ? decodeStatus(", p.JSPB("Message"), ".bytesAsU8(bytes)) : undefined;")
+		p.P("return Object.assign(err, { status, details: status?.details ?? [] });")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * Returns the first detail of err of the given message class, if any, e.g.")
+	p.P(" * findDetail(err, BadRequest).")
+	p.P(" */")
+	p.Begin(" {", p.Decl("function", "findDetail"), p.T("<T extends "+p.JSPB("Message")+">"), "(err", p.T(": StatusDetails"), ", type", p.T(": MessageConstructor<T>"), ")", p.T(": T | undefined"))
+	p.Indented(func() {
+		p.P("return err.details.find((detail)", p.T(": detail is T"), " => detail instanceof type);")
+	})
+	p.End("}")
+	p.P()
+	p.P("/**")
+	p.P(" * The error of a failed call, that is not made by grpc-web, e.g. a call over a")
+	p.P(" * WebSocket. Calls made by grpc-web fail with a grpcweb.RpcError instead, see")
+	p.P(" * withStatus.")
+	p.P(" */")
+	p.P(p.Decl("class", "StatusError"), " extends Error", p.T(" implements StatusDetails"), " {")
+	p.Indented(func() {
+		p.Types(func() {
+			p.P("readonly code: StatusCode;")
+			p.P("readonly metadata: { [key: string]: string };")
+			p.P("/** The status sent in the trailers, if any. */")
+			p.P("readonly status?: Status;")
+			p.P()
+		})
+		p.Begin(" {", "constructor(code", p.T(": StatusCode"), ", message", p.T(": string"), ", metadata", p.T("?: { [key: string]: string }"), ")")
+		p.Indented(func() {
+			p.P("super(message);")
+			p.P("this.name = \"StatusError\";")
+			p.P("this.code = code;")
+			p.P("this.metadata = metadata ?? {};")
+			p.P("const details = this.metadata[\"grpc-status-details-bin\"];")
+			p.P("if (details) {")
+			p.Indented(func() {
+				p.P("this.status = decodeStatus(", p.JSPB("Message"), ".bytesAsU8(details));")
+			})
+			p.P("}")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * The details of the status, if any.")
+		p.P(" */")
+		p.Begin(" {", "get details()", p.T(": ("+p.JSPB("Message")+" | UnknownDetail)[]"))
+		p.Indented(func() {
+			p.P("return this.status?.details ?? [];")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Returns the first detail of the given message class, if any, e.g.")
+		p.P(" * err.findDetail(BadRequest).")
+		p.P(" */")
+		p.Begin(" {", "findDetail", p.T("<T extends "+p.JSPB("Message")+">"), "(type", p.T(": MessageConstructor<T>"), ")", p.T(": T | undefined"))
+		p.Indented(func() {
+			p.P("return findDetail(this, type);")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Returns err as StatusError.")
+		p.P(" */")
+		p.Begin(" {", "static from(err", p.T(": CallError"), ")", p.T(": StatusError"))
+		p.Indented(func() {
+			p.P("return err instanceof StatusError ? err : new StatusError(err.code, err.message, err.metadata);")
+		})
+		p.End("}")
+	})
+	p.P("}")
+}
+
+// genWebSockets generates the transport of client streaming and bidirectional
+// streaming calls over WebSockets, that the generated clients use when the
+// streaming_transport parameter is set to "websocket".
+//
+// The framing is the one of the WebSocket transport of improbable-eng's
+// grpc-web: The first message holds the request headers, each further message
+// a byte that is 1 to end the requests, or 0 followed by a gRPC frame. The
+// server responds with gRPC frames, where response headers and trailers are
+// frames with the most significant bit of their flags set.
+func genWebSockets(p *Printer) {
+	p.P("/**")
+	p.P(" * Starts a call of a client streaming or bidirectional streaming method over a")
+	p.P(" * WebSocket to url, i.e. the host followed by the path of the method. A")
+	p.P(" * deadline in metadata, see callMetadata, is sent as grpc-timeout.")
+	p.P(" */")
+	p.P(p.Decl("function", "openWebSocket"), p.T("<Req, Res>"), "(")
+	p.Indented(func() {
+		p.P("url", p.T(": string"), ",")
+		p.P("metadata", p.T(": { [key: string]: string }"), ",")
+		p.P("serialize", p.T(": (request: Req) => Uint8Array"), ",")
+		p.P("deserialize", p.T(": (bytes: Uint8Array) => Res"), ",")
+		p.P("signal", p.T("?: AbortSignal"))
+	})
+	p.Begin(" {", ")", p.T(": DuplexStream<Req, Res>"))
+	p.Indented(func() {
+		p.P("const headers", p.T(": { [key: string]: string }"), " = {")
+		p.Indented(func() {
+			p.P("...metadata,")
+			p.P("\"content-type\": \"application/grpc-web+proto\",")
+			p.P("\"x-grpc-web\": \"1\",")
+		})
+		p.P("};")
+		p.P("if (headers[\"deadline\"] !== undefined) {")
+		p.Indented(func() {
+			p.P("const timeout = Math.max(0, Number(headers[\"deadline\"]) - Date.now());")
+			p.P("headers[\"grpc-timeout\"] = `${Math.ceil(timeout)}m`;")
+			p.P("delete headers[\"deadline\"];")
+		})
+		p.P("}")
+		p.P("const socket = new WebSocket(url.replace(/^http/, \"ws\"), \"grpc-websockets\");")
+		p.P("socket.binaryType = \"arraybuffer\";")
+		p.P()
+		p.P("// Messages written before the socket is open are queued.")
+		p.P("const queue", p.T(": Uint8Array[]"), " = [encodeHeaders(headers)];")
+		p.P("const write = (bytes", p.T(": Uint8Array"), ") => {")
+		p.Indented(func() {
+			p.P("if (socket.readyState === WebSocket.CONNECTING) {")
+			p.Indented(func() {
+				p.P("queue.push(bytes);")
+			})
+			p.P("} else if (socket.readyState === WebSocket.OPEN) {")
+			p.Indented(func() {
+				p.P("socket.send(bytes);")
+			})
+			p.P("}")
+		})
+		p.P("};")
+		p.P("socket.onopen = () => {")
+		p.Indented(func() {
+			p.P("for (const bytes of queue) {")
+			p.Indented(func() {
+				p.P("socket.send(bytes);")
+			})
+			p.P("}")
+			p.P("queue.length = 0;")
+		})
+		p.P("};")
+		p.P()
+		p.P("// The responses are emitted as events of a ServerStream, that is")
+		p.P("// iterated by iterateStream.")
+		p.P("const handlers", p.T(": { [eventType: string]: (...args: any[]) => void }"), " = {};")
+		p.P("let done = false;")
+		p.P("const close = () => {")
+		p.Indented(func() {
+			p.P("done = true;")
+			p.P("socket.close();")
+		})
+		p.P("};")
+		p.P("const finish = (err", p.T("?: StatusError"), ") => {")
+		p.Indented(func() {
+			p.P("if (done) {")
+			p.Indented(func() {
+				p.P("return;")
+			})
+			p.P("}")
+			p.P("close();")
+			p.P("if (err) {")
+			p.Indented(func() {
+				p.P("handlers[\"error\"]?.(err);")
+			})
+			p.P("} else {")
+			p.Indented(func() {
+				p.P("handlers[\"end\"]?.();")
+			})
+			p.P("}")
+		})
+		p.P("};")
+		p.P("const stream", p.T(": ServerStream<Res>"), " = {")
+		p.Indented(func() {
+			p.P("on(eventType", p.T(": string"), ", callback", p.T(": (...args: any[]) => void"), ") {")
+			p.Indented(func() {
+				p.P("handlers[eventType] = callback;")
+				p.P("return stream;")
+			})
+			p.P("},")
+			p.P("cancel: close,")
+		})
+		p.P("};")
+		p.P()
+		p.P("const trailers", p.T(": { [key: string]: string }"), " = {};")
+		p.P("let buffer = new Uint8Array(0);")
+		p.P("socket.onmessage = (event", p.T(": MessageEvent"), ") => {")
+		p.Indented(func() {
+			p.P("buffer = concatBytes(buffer, new Uint8Array(event.data", p.T(" as ArrayBuffer"), "));")
+			p.P("while (buffer.length >= 5) {")
+			p.Indented(func() {
+				p.P("const length = new DataView(buffer.buffer, buffer.byteOffset + 1, 4).getUint32(0);")
+				p.P("if (buffer.length < 5 + length) {")
+				p.Indented(func() {
+					p.P("break;")
+				})
+				p.P("}")
+				p.P("const flags = buffer[0];")
+				p.P("const payload = buffer.slice(5, 5 + length);")
+				p.P("buffer = buffer.slice(5 + length);")
+				p.P("if ((flags & 0x80) === 0) {")
+				p.Indented(func() {
+					p.P("handlers[\"data\"]?.(deserialize(payload));")
+					p.P("continue;")
+				})
+				p.P("}")
+				p.P("// Response headers or trailers, the latter carry the status.")
+				p.P("Object.assign(trailers, decodeHeaders(payload));")
+				p.P("if (trailers[\"grpc-status\"] === undefined) {")
+				p.Indented(func() {
+					p.P("continue;")
+				})
+				p.P("}")
+				p.P("const code = Number(trailers[\"grpc-status\"]);")
+				p.P("if (code === StatusCode.OK) {")
+				p.Indented(func() {
+					p.P("finish();")
+				})
+				p.P("} else {")
+				p.Indented(func() {
+					p.P("const message = decodeURIComponent(trailers[\"grpc-message\"] ?? \"\");")
+					p.P("finish(new StatusError(code, message, trailers));")
+				})
+				p.P("}")
+			})
+			p.P("}")
+		})
+		p.P("};")
+		p.P("socket.onerror = () => {")
+		p.Indented(func() {
+			p.P("finish(new StatusError(StatusCode.UNAVAILABLE, \"WebSocket error\"));")
+		})
+		p.P("};")
+		p.P("socket.onclose = () => {")
+		p.Indented(func() {
+			p.P("finish(new StatusError(StatusCode.UNAVAILABLE, \"WebSocket closed without status\"));")
+		})
+		p.P("};")
+		p.P()
+		p.P("const responses = iterateStream(stream, signal);")
+		p.P("return {")
+		p.Indented(func() {
+			p.P("send(request", p.T(": Req"), ") {")
+			p.Indented(func() {
+				p.P("const bytes = serialize(request);")
+				p.P("const message = new Uint8Array(6 + bytes.length);")
+				p.P("new DataView(message.buffer).setUint32(2, bytes.length);")
+				p.P("message.set(bytes, 6);")
+				p.P("write(message);")
+			})
+			p.P("},")
+			p.P("end() {")
+			p.Indented(func() {
+				p.P("write(new Uint8Array([1]));")
+			})
+			p.P("},")
+			p.P("cancel() {")
+			p.Indented(func() {
+				p.P("finish(new StatusError(StatusCode.CANCELLED, \"Cancelled by the client\"));")
+			})
+			p.P("},")
+			p.P("[Symbol.asyncIterator]() {")
+			p.Indented(func() {
+				p.P("return responses[Symbol.asyncIterator]();")
+			})
+			p.P("},")
+		})
+		p.P("};")
+	})
+	p.End("}")
+	p.P()
+	p.Impl(func() {
+		p.P("function encodeHeaders(headers", p.T(": { [key: string]: string }"), ")", p.T(": Uint8Array"), " {")
+		p.Indented(func() {
+			p.P("let s = \"\";")
+			p.P("for (const key of Object.keys(headers)) {")
+			p.Indented(func() {
+				p.P("s += `${key}: ${headers[key]}\\r\\n`;")
+			})
+			p.P("}")
+			p.P("return new TextEncoder().encode(s);")
+		})
+		p.P("}")
+		p.P()
+		p.P("function decodeHeaders(bytes", p.T(": Uint8Array"), ")", p.T(": { [key: string]: string }"), " {")
+		p.Indented(func() {
+			p.P("const headers", p.T(": { [key: string]: string }"), " = {};")
+			p.P("for (const line of new TextDecoder().decode(bytes).split(\"\\r\\n\")) {")
+			p.Indented(func() {
+				p.P("const i = line.indexOf(\":\");")
+				p.P("if (i > 0) {")
+				p.Indented(func() {
+					p.P("headers[line.substring(0, i).trim().toLowerCase()] = line.substring(i + 1).trim();")
+				})
+				p.P("}")
+			})
+			p.P("}")
+			p.P("return headers;")
+		})
+		p.P("}")
+		p.P()
+		p.P("function concatBytes(a", p.T(": Uint8Array"), ", b", p.T(": Uint8Array"), ")", p.T(": Uint8Array"), " {")
+		p.Indented(func() {
+			p.P("const result = new Uint8Array(a.length + b.length);")
+			p.P("result.set(a);")
+			p.P("result.set(b, a.length);")
+			p.P("return result;")
+		})
+		p.P("}")
+	})
+}
+
+// genMocks generates the mocks of the methods of the mock clients, that are
+// generated when the mock_client parameter is set.
+func genMocks(p *Printer) {
+	p.P("/**")
+	p.P(" * The mock of a unary method of a mock client. The calls are answered by a")
+	p.P(" * response, an error or a handler, as programmed last.")
+	p.P(" */")
+	p.P(p.Decl("class", "MockMethod"), p.T("<Req, Res>"), " {")
+	p.Indented(func() {
+		p.Types(func() {
+			p.P("/** The requests of the calls, in order. */")
+			p.P("readonly requests: Req[];")
+			p.P("private handler: (request: Req) => Res | Promise<Res>;")
+			p.P()
+		})
+		p.Begin(" {", "constructor()")
+		p.Indented(func() {
+			p.P("this.requests = [];")
+			p.P("this.handler = () => {")
+			p.Indented(func() {
+				p.P("throw new StatusError(StatusCode.UNIMPLEMENTED, \"No response programmed\");")
+			})
+			p.P("};")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Answers the calls with response.")
+		p.P(" */")
+		p.Begin(" {", "respond(response", p.T(": Res"), ")", p.T(": this"))
+		p.Indented(func() {
+			p.P("return this.handle(() => response);")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Fails the calls with err, e.g. a grpcweb.RpcError, like the calls made by")
+		p.P(" * grpc-web do.")
+		p.P(" */")
+		p.Begin(" {", "fail(err", p.T(": CallError"), ")", p.T(": this"))
+		p.Indented(func() {
+			p.P("return this.handle(() => {")
+			p.Indented(func() {
+				p.P("throw err;")
+			})
+			p.P("});")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Answers the calls with the response returned, or the error thrown, by")
+		p.P(" * handler.")
+		p.P(" */")
+		p.Begin(" {", "handle(handler", p.T(": (request: Req) => Res | Promise<Res>"), ")", p.T(": this"))
+		p.Indented(func() {
+			p.P("this.handler = handler;")
+			p.P("return this;")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Records request and returns the response to it.")
+		p.P(" */")
+		p.Begin(" {", "call(request", p.T(": Req"), ")", p.T(": Promise<Res>"))
+		p.Indented(func() {
+			p.P("this.requests.push(request);")
+			p.P("const handler = this.handler;")
+			p.P("return (async () => handler(request))();")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Records request and passes the response to it to the callback in args,")
+		p.P(" * like the unary methods of generated clients do.")
+		p.P(" */")
+		p.Begin(" {", "callback(request", p.T(": Req"), ", args", p.T(": unknown[]"), ")", p.T(": ServerStream<Res>"))
+		p.Indented(func() {
+			p.P("const callback = args.find((arg) => typeof arg === \"function\")", p.T(" as ((err: (CallError & StatusDetails) | null, response?: Res) => void) | undefined"), ";")
+			p.P("const response = this.call(request);")
+			p.P("const stream = emitResponses(")
+			p.Indented(func() {
+				p.P("(async function* () {")
+				p.Indented(func() {
+					p.P("yield await response;")
+				})
+				p.P("})()")
+			})
+			p.P(");")
+			p.P("stream.on(\"data\", (response", p.T(": Res"), ") => callback?.(null, response));")
+			p.P("stream.on(\"error\", (err", p.T(": CallError"), ") => callback?.(withStatus(err)));")
+			p.P("return stream;")
+		})
+		p.End("}")
+	})
+	p.P("}")
+	p.P()
+	p.P("/**")
+	p.P(" * The mock of a streaming method of a mock client. The responses to each")
+	p.P(" * request are given by a script or a handler, as programmed last.")
+	p.P(" *")
+	p.P(" * For client streaming and bidirectional streaming methods, the responses to")
+	p.P(" * each request sent are emitted, and the responses end once the requests end.")
+	p.P(" */")
+	p.P(p.Decl("class", "MockStream"), p.T("<Req, Res>"), " {")
+	p.Indented(func() {
+		p.Types(func() {
+			p.P("/** The requests of the calls, in order. */")
+			p.P("readonly requests: Req[];")
+			p.P("private handler: (request: Req) => Iterable<Res> | AsyncIterable<Res>;")
+			p.P()
+		})
+		p.Begin(" {", "constructor()")
+		p.Indented(func() {
+			p.P("this.requests = [];")
+			p.P("this.handler = () => [];")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Answers each request with responses, followed by err, e.g. a")
+		p.P(" * grpcweb.RpcError, if given.")
+		p.P(" */")
+		p.Begin(" {", "script(responses", p.T(": Res[]"), ", err", p.T("?: CallError"), ")", p.T(": this"))
+		p.Indented(func() {
+			p.P("return this.handle(async function* () {")
+			p.Indented(func() {
+				p.P("yield* responses;")
+				p.P("if (err) {")
+				p.Indented(func() {
+					p.P("throw err;")
+				})
+				p.P("}")
+			})
+			p.P("});")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Answers each request with the responses yielded by handler. An error")
+		p.P(" * thrown by handler fails the call.")
+		p.P(" */")
+		p.Begin(" {", "handle(handler", p.T(": (request: Req) => Iterable<Res> | AsyncIterable<Res>"), ")", p.T(": this"))
+		p.Indented(func() {
+			p.P("this.handler = handler;")
+			p.P("return this;")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Records request and returns the stream of the responses to it, like the")
+		p.P(" * server streaming methods of generated clients do.")
+		p.P(" */")
+		p.Begin(" {", "stream(request", p.T(": Req"), ")", p.T(": ServerStream<Res>"))
+		p.Indented(func() {
+			p.P("this.requests.push(request);")
+			p.P("return emitResponses(this.handler(request));")
+		})
+		p.End("}")
+		p.P()
+		p.P("/**")
+		p.P(" * Returns a call of a client streaming or bidirectional streaming method.")
+		p.P(" */")
+		p.Begin(" {", "duplex()", p.T(": DuplexStream<Req, Res>"))
+		p.Indented(func() {
+			p.P("const queue", p.T(": (Iterable<Res> | AsyncIterable<Res>)[]"), " = [];")
+			p.P("let ended = false;")
+			p.P("let wake", p.T(": (() => void) | undefined"), ";")
+			p.P("const notify = () => {")
+			p.Indented(func() {
+				p.P("wake?.();")
+				p.P("wake = undefined;")
+			})
+			p.P("};")
+			p.P("const responses = iterateStream(")
+			p.Indented(func() {
+				p.P("emitResponses(")
+				p.Indented(func() {
+					p.P("(async function* () {")
+					p.Indented(func() {
+						p.P("while (true) {")
+						p.Indented(func() {
+							p.P("if (queue.length > 0) {")
+							p.Indented(func() {
+								p.P("yield* queue.shift()", p.T("!"), ";")
+							})
+							p.P("} else if (ended) {")
+							p.Indented(func() {
+								p.P("return;")
+							})
+							p.P("} else {")
+							p.Indented(func() {
+								p.P("await new Promise", p.T("<void>"), "((resolve) => (wake = resolve));")
+							})
+							p.P("}")
+						})
+						p.P("}")
+					})
+					p.P("})()")
+				})
+				p.P(")")
+			})
+			p.P(");")
+			p.P("return {")
+			p.Indented(func() {
+				p.P("send: (request", p.T(": Req"), ") => {")
+				p.Indented(func() {
+					p.P("this.requests.push(request);")
+					p.P("queue.push(this.handler(request));")
+					p.P("notify();")
+				})
+				p.P("},")
+				p.P("end() {")
+				p.Indented(func() {
+					p.P("ended = true;")
+					p.P("notify();")
+				})
+				p.P("},")
+				p.P("cancel() {")
+				p.Indented(func() {
+					p.P("queue.length = 0;")
+					p.P("ended = true;")
+					p.P("notify();")
+				})
+				p.P("},")
+				p.P("[Symbol.asyncIterator]() {")
+				p.Indented(func() {
+					p.P("return responses[Symbol.asyncIterator]();")
+				})
+				p.P("},")
+			})
+			p.P("};")
+		})
+		p.End("}")
+	})
+	p.P("}")
+	p.P()
+	p.Impl(func() {
+		p.P("function emitResponses", p.T("<Res>"), "(responses", p.T(": Iterable<Res> | AsyncIterable<Res>"), ")", p.T(": ServerStream<Res>"), " {")
+		p.Indented(func() {
+			p.P("const listeners", p.T(": { [eventType: string]: ((...args: any[]) => void)[] }"), " = {};")
+			p.P("let cancelled = false;")
+			p.P("const emit = (eventType", p.T(": string"), ", ...args", p.T(": unknown[]"), ") => {")
+			p.Indented(func() {
+				p.P("for (const listener of listeners[eventType] ?? []) {")
+				p.Indented(func() {
+					p.P("if (!cancelled) {")
+					p.Indented(func() {
+						p.P("listener(...args);")
+					})
+					p.P("}")
+				})
+				p.P("}")
+			})
+			p.P("};")
+			p.P("const stream = {")
+			p.Indented(func() {
+				p.P("on(eventType", p.T(": string"), ", callback", p.T(": (...args: any[]) => void"), ") {")
+				p.Indented(func() {
+					p.P("listeners[eventType] = [...(listeners[eventType] ?? []), callback];")
+					p.P("return stream;")
+				})
+				p.P("},")
+				p.P("removeListener(eventType", p.T(": string"), ", callback", p.T(": (...args: any[]) => void"), ") {")
+				p.Indented(func() {
+					p.P("listeners[eventType] = (listeners[eventType] ?? []).filter((l) => l !== callback);")
+					p.P("return stream;")
+				})
+				p.P("},")
+				p.P("cancel() {")
+				p.Indented(func() {
+					p.P("cancelled = true;")
+				})
+				p.P("},")
+			})
+			p.P("};")
+			p.P("// Responses are emitted asynchronously, once listeners are added.")
+			p.P("(async () => {")
+			p.Indented(func() {
+				p.P("try {")
+				p.Indented(func() {
+					p.P("for await (const response of responses) {")
+					p.Indented(func() {
+						p.P("emit(\"data\", response);")
+					})
+					p.P("}")
+					p.P("emit(\"end\");")
+				})
+				p.P("} catch (err) {")
+				p.Indented(func() {
+					p.P("emit(\"error\", withStatus(err", p.T(" as CallError"), "));")
+				})
+				p.P("}")
+			})
+			p.P("})();")
+			p.P("return stream;")
+		})
+		p.P("}")
+	})
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/fischor/protoc-gen-ts/internal/prototype"
+	"github.com/iancoleman/strcase"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// servicesPath returns the path of the file that the services of file are
+// generated to, if the separate_services parameter is set. It is a sibling of
+// the file generated for file, e.g. "mycom/hello_grpc_web_pb.ts" for
+// "mycom/hello_pb.ts".
+func servicesPath(file *protogen.File, params parameter) string {
+	return strings.TrimSuffix(prototype.Path(file.Desc), "_pb.ts") + params.ServicesSuffix + ".ts"
+}
+
+// generateServicesFile generates the services of file to a separate file, that
+// imports the messages from the file generated for file.
+func generateServicesFile(gen *protogen.Plugin, file *protogen.File, params parameter) *Printer {
+	printers := newPrinters(gen, servicesPath(file, params), file.Desc, params)
+	for _, p := range printers {
+		prototype.Qualify = p
+		genServicesFile(gen, file, p, params)
+	}
+	return printers[0]
+}
+
+// genServicesFile generates the separate services file for file.
+func genServicesFile(gen *protogen.Plugin, file *protogen.File, p *Printer, params parameter) {
+	genHeader(gen, file, p)
+	p.P()
+
+	p.Mark()
+	defer p.Insert(func() {
+		genImports(gen, file, p, params)
+		p.P()
+	})
+
+	for _, svc := range file.Services {
+		genService(gen, file, p, svc, params)
+		p.P()
+	}
+}
+
+// methodTypes returns the Message names of the input and output type of
+// method, as seen from the file the service of method is generated to.
+func methodTypes(method *protogen.Method, params parameter) (string, string) {
+	if params.SeparateServices {
+		return prototype.QualifiedName(method.Desc.Input()), prototype.QualifiedName(method.Desc.Output())
+	}
+	return prototype.InputType(method.Desc), prototype.OutputType(method.Desc)
+}
+
+func genService(gen *protogen.Plugin, file *protogen.File, p *Printer, svc *protogen.Service, params parameter) {
+	name := string(svc.Desc.Name())
+	p.Types(func() {
+		genClientOptions(p, svc, params)
+		genClientInterface(p, svc, params)
+	})
+
+	p.P(p.Decl("class", name+"Client"), p.T(" implements I"+name+"Client"), " {")
+	p.P()
+	p.Indent()
+	genClientConstructor(p, svc)
+	genClientMethods(p, svc, params)
+	p.Outdent()
+	p.P("}") // service class end
+
+	if params.PromiseClient {
+		p.P()
+		genPromiseClient(gen, file, p, svc, params)
+	}
+
+	if params.MockClient {
+		p.P()
+		genMockClient(p, svc, params)
+	}
+
+	p.P()
+	genServiceDescriptor(p, svc, params)
+	p.P()
+
+	// Generate method descriptor and info. These are module private, thus
+	// they are not declared.
+	p.Impl(func() {
+		for _, method := range svc.Methods {
+			if prototype.IsSupported(method.Desc) {
+				genMethodDescriptor(p, method, params)
+			}
+		}
+	})
+}
+
+// genClientInterface generates the I<Service>Client interface, that declares
+// the methods of the <Service>Client class, so that other implementations,
+// e.g. test doubles, can be used in place of it.
+func genClientInterface(p *Printer, svc *protogen.Service, params parameter) {
+	name := string(svc.Desc.Name())
+	p.P("/**")
+	p.P(" * The methods of ", name, "Client.")
+	p.P(" */")
+	p.P(p.Decl("interface", "I"+name+"Client"), " {")
+	p.P()
+	p.Indent()
+	p.Signatures(func() {
+		genClientMethods(p, svc, params)
+	})
+	p.Outdent()
+	p.P("}")
+	p.P()
+}
+
+// genClientMethods generates the methods of the <Service>Client class.
+func genClientMethods(p *Printer, svc *protogen.Service, params parameter) {
+	for _, method := range svc.Methods {
+		if !prototype.IsSupported(method.Desc) {
+			genClientStreamingMethod(p, method, params)
+			continue
+		}
+		if method.Desc.IsStreamingServer() {
+			genServerStreamingMethod(p, method, params)
+			continue
+		}
+		genUnaryMethod(p, method, params)
+	}
+}
+
+// genServiceDescriptor generates the exported <Service>Service descriptor of
+// svc, that lists the methods of svc for generic tooling, along with the
+// <Service>Methods type of its methods. The latter is a type alias rather than
+// an interface, so that it satisfies the index signature of
+// runtime.ServiceInfo.
+func genServiceDescriptor(p *Printer, svc *protogen.Service, params parameter) {
+	name := string(svc.Desc.Name())
+	p.Types(func() {
+		p.P("/**")
+		p.P(" * The methods of ", name, " by their lower camel case names.")
+		p.P(" */")
+		p.P(p.Decl("type", name+"Methods"), " = {")
+		p.Indented(func() {
+			for _, method := range svc.Methods {
+				input, output := methodTypes(method, params)
+				p.P("readonly ", strcase.ToLowerCamel(string(method.Desc.Name())), ": ", p.Runtime("ServiceMethodInfo"), "<", input, ", ", output, ">;")
+			}
+		})
+		p.P("};")
+		p.P()
+	})
+	p.P("/**")
+	p.P(" * The descriptor of the service ", svc.Desc.FullName(), ".")
+	p.P(" */")
+	p.Begin(" = {", p.Decl("const", name+"Service"), p.T(": "+p.Runtime("ServiceInfo")+"<"+name+"Methods>"))
+	p.Indented(func() {
+		p.P("typeName: \"", svc.Desc.FullName(), "\",")
+		p.P("methods: {")
+		p.Indented(func() {
+			for _, method := range svc.Methods {
+				input, output := methodTypes(method, params)
+				opts, _ := method.Desc.Options().(*descriptorpb.MethodOptions)
+				p.P(strcase.ToLowerCamel(string(method.Desc.Name())), ": {")
+				p.Indented(func() {
+					p.P("name: \"", method.Desc.Name(), "\",")
+					p.P("path: \"", prototype.Address(method.Desc), "\",")
+					p.P("kind: \"", prototype.StreamingKind(method.Desc), "\",")
+					p.P("requestType: ", input, ",")
+					p.P("responseType: ", output, ",")
+					p.P("options: {")
+					p.Indented(func() {
+						p.P("deprecated: ", opts.GetDeprecated(), ",")
+						p.P("idempotencyLevel: \"", opts.GetIdempotencyLevel(), "\",")
+					})
+					p.P("},")
+				})
+				p.P("},")
+			}
+		})
+		p.P("},")
+	})
+	p.End("};")
+}
+
+// genClientOptions generates the options type of the clients of svc, that
+// types the interceptors by the requests and responses of svc.
+//
+// Interceptors are passed to grpc-web as they are. The method descriptor of an
+// intercepted call is returned by request.getMethodDescriptor(), it is the one
+// generated by genMethodDescriptor.
+func genClientOptions(p *Printer, svc *protogen.Service, params parameter) {
+	var inputs, outputs []string
+	seen := make(map[string]bool)
+	for _, method := range svc.Methods {
+		if !prototype.IsSupported(method.Desc) {
+			continue
+		}
+		input, output := methodTypes(method, params)
+		if !seen["in:"+input] {
+			seen["in:"+input] = true
+			inputs = append(inputs, input)
+		}
+		if !seen["out:"+output] {
+			seen["out:"+output] = true
+			outputs = append(outputs, output)
+		}
+	}
+	name := string(svc.Desc.Name())
+	if len(inputs) == 0 {
+		// Services without supported methods.
+		inputs, outputs = []string{"never"}, []string{"never"}
+	}
+	p.P("/**")
+	p.P(" * The request messages of the methods of ", name, ".")
+	p.P(" */")
+	p.P(p.Decl("type", name+"ClientRequest"), " = ", strings.Join(inputs, " | "), ";")
+	p.P()
+	p.P("/**")
+	p.P(" * The response messages of the methods of ", name, ".")
+	p.P(" */")
+	p.P(p.Decl("type", name+"ClientResponse"), " = ", strings.Join(outputs, " | "), ";")
+	p.P()
+	p.P("/**")
+	p.P(" * Intercepts the unary calls of the clients of ", name, ".")
+	p.P(" *")
+	p.P(" * The method that is called is described by request.getMethodDescriptor().")
+	p.P(" */")
+	p.P(p.Decl("type", name+"UnaryInterceptor"), " = ", p.GRPCWeb("UnaryInterceptor"), "<", name, "ClientRequest, ", name, "ClientResponse>;")
+	p.P()
+	p.P("/**")
+	p.P(" * Intercepts the server streaming calls of the clients of ", name, ".")
+	p.P(" *")
+	p.P(" * The method that is called is described by request.getMethodDescriptor().")
+	p.P(" */")
+	p.P(p.Decl("type", name+"StreamInterceptor"), " = ", p.GRPCWeb("StreamInterceptor"), "<", name, "ClientRequest, ", name, "ClientResponse>;")
+	p.P()
+	p.P("/**")
+	p.P(" * Options of the clients of ", name, ".")
+	p.P(" */")
+	p.P(p.Decl("interface", name+"ClientOptions"), " extends ", p.GRPCWeb("GrpcWebClientBaseOptions"), " {")
+	p.Indented(func() {
+		p.P("/** The interceptors of unary calls, the first one is called first. */")
+		p.P("unaryInterceptors?: ", name, "UnaryInterceptor[];")
+		p.P("/** The interceptors of server streaming calls, the first one is called first. */")
+		p.P("streamInterceptors?: ", name, "StreamInterceptor[];")
+	})
+	p.P("}")
+	p.P()
+}
+
+// genClientConstructor generates the fields and the constructor of a client
+// class of svc. The options default to the grpc-web-text format without
+// credentials.
+func genClientConstructor(p *Printer, svc *protogen.Service) {
+	p.P(p.T("private "), "client", p.T(": "+p.GRPCWeb("GrpcWebClientBase")), ";")
+	p.P(p.T("private "), "hostname", p.T(": string"), ";")
+	p.P()
+
+	// Constructor
+	p.Begin(" {", "constructor(hostname", p.T(": string"), ", options", p.T("?: "+string(svc.Desc.Name())+"ClientOptions"), ")")
+	p.Indented(func() {
+		p.P("this.hostname = hostname;")
+		p.P("this.client = new ", p.GRPCWeb("GrpcWebClientBase"), "({")
+		p.Indented(func() {
+			p.P("format: \"text\",")
+			p.P("withCredentials: false,")
+			p.P("...options,")
+		})
+		p.P("});")
+	})
+	p.End("}") // constructor end
+	p.P()
+}
+
+// genUnaryMethod generates the client method for the unary method, that passes
+// the response to a callback. The metadata can be omitted, in which case the
+// callback is the second argument.
+func genUnaryMethod(p *Printer, method *protogen.Method, params parameter) {
+	input, output := methodTypes(method, params)
+	name := strcase.ToLowerCamel(string(method.Desc.Name()))
+	callback := "(err: " + p.GRPCWeb("RpcError") + " & " + p.Runtime("StatusDetails") + ", response: " + output + ") => void"
+	p.Types(func() {
+		p.P(name, "(")
+		p.Indented(func() {
+			p.P("request: ", input, ",")
+			p.P("metadata: ", p.GRPCWeb("Metadata"), " | undefined,")
+			p.P("callback: ", callback, ",")
+			p.P("options?: ", p.Runtime("CallOptions"))
+		})
+		p.P("): ", p.GRPCWeb("ClientReadableStream"), "<", output, ">;")
+		p.P(name, "(request: ", input, ", callback: ", callback, "): ", p.GRPCWeb("ClientReadableStream"), "<", output, ">;")
+	})
+	// The implementation signature is not part of the declarations.
+	p.Impl(func() {
+		p.P(name, "(")
+		p.Indented(func() {
+			p.P("request", p.T(": "+input), ",")
+			p.P("metadata", p.T("?: "+p.GRPCWeb("Metadata")+" | ("+callback+")"), ",")
+			p.P("callback", p.T("?: "+callback), ",")
+			p.P("options", p.T("?: "+p.Runtime("CallOptions")))
+		})
+		p.Begin(" {", ")", p.T(": "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"))
+		p.Indented(func() {
+			p.P("if (typeof metadata === \"function\") {")
+			p.Indented(func() {
+				p.P("return this.", name, "(request, undefined, metadata);")
+			})
+			p.P("}")
+			p.P("const stream = this.client.rpcCall(")
+			p.Indented(func() {
+				p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
+				p.P("request,")
+				p.P(p.Runtime("callMetadata"), "(metadata, options),")
+				p.P(methodDescriptorName(method), ",")
+				p.P("(err, response) => callback", p.T("!"), "(err && ", p.Runtime("withStatus"), "(err), response)")
+			})
+			p.P(");")
+			p.P("return ", p.Runtime("bindSignal"), "(stream, options?.signal);")
+		})
+		p.End("}") // method end
+	})
+	p.P()
+}
+
+// genPromiseClient generates the <Service>PromiseClient class, whose unary
+// methods return a Promise of the response instead of taking a callback.
+//
+// The Promise is rejected with a grpcweb.RpcError if the call fails, whose
+// status is decoded by runtime.withStatus.
+func genPromiseClient(gen *protogen.Plugin, file *protogen.File, p *Printer, svc *protogen.Service, params parameter) {
+	p.P("/**")
+	p.P(" * Client for ", svc.Desc.Name(), ", whose unary methods return a Promise of")
+	p.P(" * the response, that is rejected with a grpcweb.RpcError if the call fails.")
+	p.P(" */")
+	p.P(p.Decl("class", string(svc.Desc.Name())+"PromiseClient"), " {")
+	p.P()
+	p.Indent()
+	genClientConstructor(p, svc)
+
+	for _, method := range svc.Methods {
+		if !prototype.IsSupported(method.Desc) {
+			genClientStreamingMethod(p, method, params)
+			continue
+		}
+		if method.Desc.IsStreamingServer() {
+			genServerStreamingMethod(p, method, params)
+			continue
+		}
+		input, output := methodTypes(method, params)
+		p.Begin(" {", strcase.ToLowerCamel(string(method.Desc.Name())), "(request", p.T(": "+input), ", metadata", p.T("?: "+p.GRPCWeb("Metadata")), ", options", p.T("?: "+p.Runtime("CallOptions")), ")", p.T(": Promise<"+output+">"))
+		p.Indented(func() {
+			// grpc-web cancels the call when the signal of the options
+			// passed to thenableCall is aborted.
+			p.P("return this.client.thenableCall(")
+			p.Indented(func() {
+				p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
+				p.P("request,")
+				p.P(p.Runtime("callMetadata"), "(metadata, options),")
+				p.P(methodDescriptorName(method), ",")
+				p.P("options")
+			})
+			p.P(").catch((err) => {")
+			p.Indented(func() {
+				p.P("throw ", p.Runtime("withStatus"), "(err);")
+			})
+			p.P("});")
+		})
+		p.End("}") // method end
+		p.P()
+	}
+
+	p.Outdent()
+	p.P("}") // promise client class end
+}
+
+// genServerStreamingMethod generates the client method for the server
+// streaming method. The responses are emitted as "data" events of the returned
+// stream, followed by the "status" and the "end" event.
+//
+// With the async_iterable parameter set, an AsyncIterable of the responses is
+// returned instead, see genAsyncIterableMethod.
+func genServerStreamingMethod(p *Printer, method *protogen.Method, params parameter) {
+	if params.AsyncIterable {
+		genAsyncIterableMethod(p, method, params)
+		return
+	}
+	input, output := methodTypes(method, params)
+	p.Begin(" {", strcase.ToLowerCamel(string(method.Desc.Name())), "(request", p.T(": "+input), ", metadata", p.T("?: "+p.GRPCWeb("Metadata")), ", options", p.T("?: "+p.Runtime("CallOptions")), ")", p.T(": "+p.GRPCWeb("ClientReadableStream")+"<"+output+">"))
+	p.Indented(func() {
+		p.P("const stream = this.client.serverStreaming(")
+		p.Indented(func() {
+			p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
+			p.P("request,")
+			p.P(p.Runtime("callMetadata"), "(metadata, options),")
+			p.P(methodDescriptorName(method))
+		})
+		p.P(");")
+		p.P("return ", p.Runtime("bindSignal"), "(stream, options?.signal);")
+	})
+	p.End("}") // method end
+	p.P()
+}
+
+// genAsyncIterableMethod generates the client method for the server streaming
+// method, that returns an AsyncIterable of the responses. The call is
+// cancelled when the signal of the call options is aborted.
+func genAsyncIterableMethod(p *Printer, method *protogen.Method, params parameter) {
+	input, output := methodTypes(method, params)
+	p.Begin(" {", strcase.ToLowerCamel(string(method.Desc.Name())), "(request", p.T(": "+input), ", options", p.T("?: "+p.Runtime("CallOptions")), ")", p.T(": AsyncIterable<"+output+">"))
+	p.Indented(func() {
+		p.P("return ", p.Runtime("iterateStream"), "(")
+		p.Indented(func() {
+			p.P("this.client.serverStreaming(")
+			p.Indented(func() {
+				p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
+				p.P("request,")
+				p.P(p.Runtime("callMetadata"), "(undefined, options),")
+				p.P(methodDescriptorName(method))
+			})
+			p.P("),")
+			p.P("options?.signal")
+		})
+		p.P(");")
+	})
+	p.End("}") // method end
+	p.P()
+}
+
+// genClientStreamingMethod generates the client method for a client streaming
+// or bidirectional streaming method, that grpc-web does not support. With the
+// streaming_transport parameter set, the method is called over a WebSocket,
+// otherwise the unsupported_streaming parameter applies.
+func genClientStreamingMethod(p *Printer, method *protogen.Method, params parameter) {
+	if params.StreamingTransport != streamingTransportWebSocket {
+		genUnsupportedMethod(p, method, params)
+		return
+	}
+	input, output := methodTypes(method, params)
+	p.Begin(" {", strcase.ToLowerCamel(string(method.Desc.Name())), "(metadata", p.T("?: "+p.GRPCWeb("Metadata")), ", options", p.T("?: "+p.Runtime("CallOptions")), ")", p.T(": "+p.Runtime("DuplexStream")+"<"+input+", "+output+">"))
+	p.Indented(func() {
+		p.P("return ", p.Runtime("openWebSocket"), "(")
+		p.Indented(func() {
+			p.P("this.hostname + \"", prototype.Address(method.Desc), "\",")
+			p.P(p.Runtime("callMetadata"), "(metadata, options),")
+			p.P("(req", p.T(": "+input), ") => req.serializeBinary(),")
+			p.P(output, ".deserializeBinary,")
+			p.P("options?.signal")
+		})
+		p.P(");")
+	})
+	p.End("}") // method end
+	p.P()
+}
+
+// genUnsupportedMethod generates the client method for a client streaming or
+// bidirectional streaming method, depending on the unsupported_streaming
+// parameter: a comment in place of the method, or a method that throws a
+// StatusError with the code UNIMPLEMENTED.
+func genUnsupportedMethod(p *Printer, method *protogen.Method, params parameter) {
+	name := strcase.ToLowerCamel(string(method.Desc.Name()))
+	if params.UnsupportedStreaming == unsupportedStreamingSkip {
+		p.P("// ", name, " is not generated, since grpc-web does not support the client")
+		p.P("// streaming method ", method.Desc.FullName(), ".")
+		p.P()
+		return
+	}
+	p.P("/**")
+	p.P(" * Not supported, since grpc-web does not support the client streaming method")
+	p.P(" * ", method.Desc.FullName(), ". Throws a StatusError with the code UNIMPLEMENTED.")
+	p.P(" */")
+	p.Begin(" {", name, "(...args", p.T(": unknown[]"), ")", p.T(": never"))
+	p.Indented(func() {
+		p.P("throw new ", p.Runtime("StatusError"), "(")
+		p.Indented(func() {
+			p.P(p.Runtime("StatusCode"), ".UNIMPLEMENTED,")
+			p.P("\"", method.Desc.FullName(), " is not supported: grpc-web does not support client streaming\"")
+		})
+		p.P(");")
+	})
+	p.End("}") // method end
+	p.P()
+}
+
+func genMethodDescriptor(p *Printer, method *protogen.Method, params parameter) {
+	input, output := methodTypes(method, params)
+	p.P("const ", methodDescriptorName(method), " = new ", p.GRPCWeb("MethodDescriptor"), p.T("<"+input+", "+output+">"), "(")
+	p.Indented(func() {
+		p.F("\"%s\",", prototype.Address(method.Desc))
+		p.F("\"%s\",", prototype.MethodType(method.Desc))
+		p.P(input, ",")
+		p.P(output, ",")
+		p.P("(req", p.T(": "+input), ") => req.serializeBinary(),")
+		p.P(output, ".deserializeBinary")
+	})
+	p.P(");")
+	p.P()
+}
+
+func methodDescriptorName(m *protogen.Method) string {
+	return "methodDescriptor_" + string(m.Desc.Parent().Name()) + "_" + string(m.Desc.Name())
+}